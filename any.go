@@ -0,0 +1,213 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxAnyElements bounds the elements read from one slice, array or map by
+// Any. Nesting is bounded by maxNestingDepth like other objects.
+const maxAnyElements = 256
+
+// Any creates a field of the type that fits value. Primitive kinds, times,
+// durations, errors and []byte keep their types; slices and arrays become
+// arrays and maps become objects with sorted keys. json.Marshaler output
+// is logged as the equivalent objects, arrays and values, and
+// encoding.TextMarshaler and fmt.Stringer output as a string. Nil pointers
+// are logged as <nil>, without calling their methods. Anything else is
+// formatted with fmt.Sprint.
+//
+// Slices, arrays and maps are read when the field is first logged, up to
+// 256 elements each. Which entries of a larger map are logged is
+// unspecified.
+func Any(key string, value any) Field {
+	return kvField(key, value)
+}
+
+// reflectField creates the field for a value of a type kvField has no case
+// for, based on its kind. Pointers and interfaces are followed.
+func reflectField(key string, value any) Field {
+	v := reflect.ValueOf(value)
+	for i := 0; v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface; i++ {
+		if v.IsNil() {
+			return String(key, "<nil>")
+		}
+		if i == maxNestingDepth {
+			return String(key, fmt.Sprint(value))
+		}
+		v = v.Elem()
+	}
+	if v.CanInterface() && v.Type() != reflect.TypeOf(value) {
+		// The pointed-to type may have a case of its own
+		return kvField(key, v.Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return Bool(key, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Int64(key, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return Uint64(key, v.Uint())
+	case reflect.Float32:
+		return Float32(key, float32(v.Float()))
+	case reflect.Float64:
+		return Float64(key, v.Float())
+	case reflect.String:
+		return String(key, v.String())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return Bytes(key, v.Bytes())
+		}
+		return Array(key, &reflectArray{v: v})
+	case reflect.Array:
+		return Array(key, &reflectArray{v: v})
+	case reflect.Map:
+		return Object(key, &reflectMap{v: v})
+	default:
+		return String(key, fmt.Sprint(value))
+	}
+}
+
+// isNilPointer reports whether v holds a nil pointer
+func isNilPointer(v any) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
+
+// reflectArray logs the elements of a slice or array. They are read once,
+// on the first call, so every call appends the same elements.
+type reflectArray struct {
+	v      reflect.Value
+	once   sync.Once
+	fields []Field
+}
+
+// MarshalLogArray appends up to maxAnyElements elements
+func (a *reflectArray) MarshalLogArray(enc ArrayEncoder) error {
+	a.once.Do(func() {
+		a.fields = make([]Field, min(a.v.Len(), maxAnyElements))
+		for i := range a.fields {
+			a.fields[i] = Any("", reflectInterface(a.v.Index(i)))
+		}
+	})
+	for _, f := range a.fields {
+		enc.AppendAny(f)
+	}
+	return nil
+}
+
+// reflectMap logs the entries of a map, sorted by key. They are read once,
+// on the first call, so every call adds the same entries.
+type reflectMap struct {
+	v      reflect.Value
+	once   sync.Once
+	fields []Field
+}
+
+// MarshalLogObject adds up to maxAnyElements entries. Only that many are
+// read from a larger map, so which ones are logged is unspecified.
+func (m *reflectMap) MarshalLogObject(enc ObjectEncoder) error {
+	m.once.Do(m.read)
+	for _, f := range m.fields {
+		enc.AddField(f)
+	}
+	return nil
+}
+
+// read reads up to maxAnyElements entries and sorts them by key
+func (m *reflectMap) read() {
+	type entry struct {
+		key string
+		val reflect.Value
+	}
+	n := min(m.v.Len(), maxAnyElements)
+	entries := make([]entry, 0, n)
+	for it := m.v.MapRange(); len(entries) < n && it.Next(); {
+		entries = append(entries, entry{mapKeyString(it.Key()), it.Value()})
+	}
+	slices.SortFunc(entries, func(a, b entry) int { return strings.Compare(a.key, b.key) })
+
+	m.fields = make([]Field, len(entries))
+	for i, e := range entries {
+		m.fields[i] = Any(e.key, reflectInterface(e.val))
+	}
+}
+
+// reflectInterface returns the value held by v, or its formatting when v
+// came from an unexported struct field
+func reflectInterface(v reflect.Value) any {
+	if v.CanInterface() {
+		return v.Interface()
+	}
+	return v.String()
+}
+
+// mapKeyString formats a map key the way encoding/json does
+func mapKeyString(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	if tm, ok := reflectInterface(k).(encoding.TextMarshaler); ok {
+		if text, err := tm.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10)
+	}
+	return fmt.Sprint(reflectInterface(k))
+}
+
+// jsonField logs the output of a json.Marshaler as the objects, arrays and
+// values it describes. A marshaling failure is logged as the error.
+func jsonField(key string, m json.Marshaler) Field {
+	data, err := m.MarshalJSON()
+	if err != nil {
+		return NamedErr(key, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return NamedErr(key, err)
+	}
+	if v == nil {
+		return String(key, "<nil>")
+	}
+	return kvField(key, v)
+}
+
+// jsonNumberField logs a JSON number as an integer if it is one that fits,
+// as a float if it has a fraction or exponent, and as written otherwise
+func jsonNumberField(key string, n json.Number) Field {
+	if i, err := n.Int64(); err == nil {
+		return Int64(key, i)
+	}
+	if strings.ContainsAny(string(n), ".eE") {
+		if f, err := n.Float64(); err == nil {
+			return Float64(key, f)
+		}
+	}
+	return String(key, string(n))
+}
+
+// textField logs the output of an encoding.TextMarshaler as a string. A
+// marshaling failure is logged as the error.
+func textField(key string, m encoding.TextMarshaler) Field {
+	text, err := m.MarshalText()
+	if err != nil {
+		return NamedErr(key, err)
+	}
+	return String(key, string(text))
+}
@@ -0,0 +1,161 @@
+package zlog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+type testLevelName int
+
+type testName string
+
+type testJSONValue struct{}
+
+func (testJSONValue) MarshalJSON() ([]byte, error) {
+	return []byte(`{"b":[true,"x",null],"a":1,"c":1.5,"big":123456789012345678901234567890}`), nil
+}
+
+type testTextValue struct{ s string }
+
+func (t testTextValue) MarshalText() ([]byte, error) { return []byte("text:" + t.s), nil }
+
+type testBadJSON struct{}
+
+func (testBadJSON) MarshalJSON() ([]byte, error) { return nil, errors.New("cannot marshal") }
+
+type testPoint struct{ X, Y int }
+
+// testNilStringer and testNilError have methods that panic on a nil
+// receiver
+type testNilStringer struct{ s string }
+
+func (p *testNilStringer) String() string { return p.s }
+
+type testNilError struct{ s string }
+
+func (p *testNilError) Error() string { return p.s }
+
+func anyJSON(t *testing.T, value any) string {
+	t.Helper()
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&buf))
+	logger.Info("m", Any("v", value))
+
+	out := strings.TrimSpace(buf.String())
+	i := strings.Index(out, `"v":`)
+	if i < 0 || !strings.HasSuffix(out, "}") {
+		t.Fatalf("no field in %s", out)
+	}
+	return out[i+len(`"v":`) : len(out)-1]
+}
+
+func TestAny(t *testing.T) {
+	n := 42
+	var nilPtr *int
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"Int", 42, `42`},
+		{"NamedInt", testLevelName(3), `3`},
+		{"Uint8", uint8(200), `200`},
+		{"Float", 2.5, `2.5`},
+		{"Bool", true, `true`},
+		{"NamedString", testName("x"), `"x"`},
+		{"Bytes", []byte("hi"), `"aGk="`},
+		{"Error", errors.New("boom"), `{"message":"boom","type":"*errors.errorString"}`},
+		{"Slice", []int{1, 2, 3}, `[1,2,3]`},
+		{"EmptySlice", []string{}, `[]`},
+		{"Array", [2]string{"a", "b"}, `["a","b"]`},
+		{"Map", map[string]int{"b": 2, "a": 1}, `{"a":1,"b":2}`},
+		{"IntKeys", map[int]bool{10: true, 9: false}, `{"10":true,"9":false}`},
+		{"Nested", map[string]any{"ids": []int{1}, "ok": true}, `{"ids":[1],"ok":true}`},
+		{"Pointer", &n, `42`},
+		{"NilPointer", nilPtr, `"<nil>"`},
+		{"Nil", nil, `"<nil>"`},
+		{"JSONMarshaler", testJSONValue{}, `{"a":1,"b":[true,"x","<nil>"],"big":"123456789012345678901234567890","c":1.5}`},
+		{"JSONMarshalerError", testBadJSON{}, `{"message":"cannot marshal","type":"*errors.errorString"}`},
+		{"TextMarshaler", testTextValue{"a"}, `"text:a"`},
+		{"NilStringer", (*testNilStringer)(nil), `"<nil>"`},
+		{"NilTextMarshaler", (*testTextValue)(nil), `"<nil>"`},
+		{"NilError", (*testNilError)(nil), `{"message":"<nil>"}`},
+		{"Struct", testPoint{1, 2}, `"{1 2}"`},
+		{"PointerToStruct", &testPoint{1, 2}, `"{1 2}"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := anyJSON(t, tt.value); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnyBounded(t *testing.T) {
+	long := make([]int, 1000)
+	got := anyJSON(t, long)
+	if n := strings.Count(got, ",") + 1; n != maxAnyElements {
+		t.Errorf("recorded %d elements, want %d", n, maxAnyElements)
+	}
+
+	self := map[string]any{}
+	self["self"] = self
+	got = anyJSON(t, self)
+	if depth := strings.Count(got, `{"self":`); depth != maxNestingDepth {
+		t.Errorf("nested %d levels deep, want %d", depth, maxNestingDepth)
+	}
+}
+
+func TestAnyLargeMap(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful under the race detector")
+	}
+	large := make(map[int]int, 100000)
+	for i := range 100000 {
+		large[i] = i
+	}
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(io.Discard))
+
+	// Reading every entry would format 100000 keys
+	allocs := testing.AllocsPerRun(1, func() {
+		logger.Info("m", Any("m", large), Any("nested", []any{large}))
+	})
+	if allocs > 20*maxAnyElements {
+		t.Errorf("%.0f allocs to log a large map", allocs)
+	}
+
+	for _, got := range []string{anyJSON(t, large), anyJSON(t, []any{large})} {
+		if n := strings.Count(got, ":"); n != maxAnyElements {
+			t.Errorf("recorded %d entries, want %d: %.80s", n, maxAnyElements, got)
+		}
+	}
+}
+
+func TestAnyLogfmt(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewLogfmtWriter(&buf))
+	logger.Info("m", Any("req", map[string]any{"ids": []int{4, 5}, "path": "/"}))
+
+	if !strings.Contains(buf.String(), " req.ids.0=4 req.ids.1=5 req.path=/") {
+		t.Errorf("unexpected output %s", buf.String())
+	}
+}
+
+func TestAnyKV(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&buf))
+	logger.InfoKV("m", "tags", []string{"a", "b"}, "count", testLevelName(2))
+
+	if !strings.HasSuffix(buf.String(), `"tags":["a","b"],"count":2}`+"\n") {
+		t.Errorf("unexpected output %s", buf.String())
+	}
+}
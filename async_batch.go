@@ -0,0 +1,123 @@
+package zlog
+
+import (
+	"net"
+	"time"
+)
+
+// SetOrdered makes records reach the underlying writer in the order their
+// writes were queued. Workers then take turns, so only one write to the
+// underlying writer runs at a time; with several workers, records written
+// concurrently may otherwise land out of order. Set it before the writer
+// is in use.
+func (aw *AsyncWriterV2) SetOrdered(ordered bool) {
+	aw.ordered.Store(ordered)
+}
+
+// SetBatching makes workers coalesce consecutive queued records into one
+// write of up to maxBytes; a record larger than maxBytes is written on its
+// own. A worker holding a partial batch waits up to maxLatency for more
+// records before writing it, unless Flush or Close is called. Batches to a
+// net.Conn are written with net.Buffers, using writev where the connection
+// supports it, and copied into one buffer otherwise. maxBytes <= 0
+// disables batching. Set it before the writer is in use.
+func (aw *AsyncWriterV2) SetBatching(maxBytes int, maxLatency time.Duration) {
+	aw.batchLatency.Store(int64(maxLatency))
+	aw.batchBytes.Store(int64(maxBytes))
+}
+
+// batch is a worker's batch of entries to write together
+type batch struct {
+	entries []*LogEntry
+	buf     []byte      // Coalesced data
+	bufs    net.Buffers // Data for a net.Conn
+	size    int
+}
+
+// consume writes the next queued entry, or a batch starting with it. It
+// returns false if the ring buffer was empty.
+func (aw *AsyncWriterV2) consume(b *batch) bool {
+	if aw.ordered.Load() {
+		aw.consumer.Lock()
+		defer aw.consumer.Unlock()
+	}
+
+	entry, ok := aw.rb.Get()
+	if !ok {
+		return false
+	}
+	maxBytes := int(aw.batchBytes.Load())
+	if maxBytes <= 0 {
+		aw.write(entry)
+		return true
+	}
+
+	b.add(entry)
+	deadline := nanotime() + aw.batchLatency.Load()
+	for {
+		next, ok := aw.rb.Get()
+		if !ok {
+			if nanotime() >= deadline || aw.stop.Load() || aw.flushing.Load() != 0 {
+				break
+			}
+			aw.waitBatch(deadline)
+			continue
+		}
+		if b.size+len(next.data) > maxBytes {
+			aw.writeBatch(b)
+			deadline = nanotime() + aw.batchLatency.Load()
+		}
+		b.add(next)
+	}
+	aw.writeBatch(b)
+	return true
+}
+
+// waitBatch waits for more records until deadline, the nanotime at which
+// a partial batch is due
+func (aw *AsyncWriterV2) waitBatch(deadline int64) {
+	// The deadline may have passed since the caller checked it
+	remaining := time.Duration(deadline - nanotime())
+	if remaining <= 0 || IdleStrategy(aw.idle.Load()) == IdleBusySpin {
+		return
+	}
+	aw.park(remaining, true)
+}
+
+// add adds an entry to the batch
+func (b *batch) add(entry *LogEntry) {
+	b.entries = append(b.entries, entry)
+	b.size += len(entry.data)
+}
+
+// writeBatch writes the entries of b with one write and recycles them
+func (aw *AsyncWriterV2) writeBatch(b *batch) {
+	if len(b.entries) == 0 {
+		return
+	}
+
+	if _, ok := aw.writer.(net.Conn); ok {
+		for _, entry := range b.entries {
+			b.bufs = append(b.bufs, entry.data)
+		}
+		bufs := b.bufs // WriteTo consumes the slice
+		bufs.WriteTo(aw.writer)
+		clear(b.bufs)
+		b.bufs = b.bufs[:0]
+	} else {
+		for _, entry := range b.entries {
+			b.buf = append(b.buf, entry.data...)
+		}
+		aw.writer.Write(b.buf)
+		b.buf = b.buf[:0]
+	}
+
+	for i, entry := range b.entries {
+		aw.pending[entry.gen].Add(-1)
+		entry.data = entry.data[:0]
+		aw.pool.Put(entry)
+		b.entries[i] = nil
+	}
+	b.entries = b.entries[:0]
+	b.size = 0
+}
@@ -0,0 +1,283 @@
+package zlog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchWriter records every write it receives
+type batchWriter struct {
+	mu     sync.Mutex
+	writes []int
+	data   bytes.Buffer
+}
+
+func (w *batchWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes = append(w.writes, len(p))
+	return w.data.Write(p)
+}
+
+// written returns the data written so far
+func (w *batchWriter) written() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.data.String()
+}
+
+func TestAsyncWriterOrdered(t *testing.T) {
+	const records = 5000
+
+	var got []int
+	w := &testCapture{fn: func(p []byte) error {
+		n, _ := strconv.Atoi(string(p))
+		got = append(got, n) // Ordered writes never run concurrently
+		return nil
+	}}
+	aw := NewAsyncWriterV2(w, 64, 4)
+	aw.SetOrdered(true)
+
+	for i := 0; i < records; i++ {
+		aw.Write([]byte(strconv.Itoa(i)))
+	}
+	aw.Close()
+
+	if len(got) != records {
+		t.Fatalf("%d of %d records written", len(got), records)
+	}
+	for i, n := range got {
+		if n != i {
+			t.Fatalf("record %d written at position %d", n, i)
+		}
+	}
+}
+
+func TestAsyncWriterBatching(t *testing.T) {
+	w := &batchWriter{}
+	aw := NewAsyncWriterV2(w, 256, 2)
+	aw.SetOrdered(true)
+	aw.SetBatching(100, 10*time.Millisecond)
+
+	var want bytes.Buffer
+	for i := 0; i < 200; i++ {
+		record := fmt.Sprintf("record %03d\n", i)
+		want.WriteString(record)
+		aw.Write([]byte(record))
+	}
+	if err := aw.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.data.String() != want.String() {
+		t.Errorf("batched output differs:\n%s", w.data.String())
+	}
+	if len(w.writes) >= 200 {
+		t.Errorf("%d writes for 200 records", len(w.writes))
+	}
+	for _, n := range w.writes {
+		if n > 100 {
+			t.Errorf("batch of %d bytes exceeds 100", n)
+		}
+	}
+	aw.Close()
+}
+
+func TestAsyncWriterBatchLatency(t *testing.T) {
+	w := &batchWriter{}
+	aw := NewAsyncWriterV2(w, 16, 1)
+	aw.SetBatching(1<<20, 20*time.Millisecond)
+	defer aw.Close()
+
+	start := time.Now()
+	aw.Write([]byte("lonely record"))
+	for w.written() == "" {
+		if time.Since(start) > time.Second {
+			t.Fatal("partial batch not written")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("partial batch written after %v, before its latency", elapsed)
+	}
+	if got := w.written(); got != "lonely record" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestAsyncWriterBatchTinyLatency(t *testing.T) {
+	w := &batchWriter{}
+	aw := NewAsyncWriterV2(w, 16, 1)
+	aw.SetBatching(1<<20, time.Microsecond)
+	defer aw.Close()
+
+	// The latency passes while the worker is between records, so it must
+	// write each partial batch instead of sleeping on it
+	want := ""
+	for i := 0; i < 100; i++ {
+		aw.Write([]byte("r"))
+		want += "r"
+		deadline := time.Now().Add(time.Second)
+		for w.written() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("record %d not written without Flush", i)
+			}
+			time.Sleep(10 * time.Microsecond)
+		}
+	}
+
+	// A deadline that passed after the worker checked it
+	done := make(chan struct{})
+	go func() {
+		aw.waitBatch(nanotime() - 1)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("waitBatch slept past its deadline")
+	}
+}
+
+func TestAsyncWriterBatchFlush(t *testing.T) {
+	w := &batchWriter{}
+	aw := NewAsyncWriterV2(w, 16, 2)
+	aw.SetBatching(1<<20, 2*time.Second)
+
+	start := time.Now()
+	aw.Write([]byte("flushed "))
+	if err := aw.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Flush returned after %v, waiting for the batch latency", elapsed)
+	}
+	if got := w.written(); got != "flushed " {
+		t.Errorf("got %q after Flush", got)
+	}
+
+	start = time.Now()
+	aw.Write([]byte("closed"))
+	aw.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close returned after %v, waiting for the batch latency", elapsed)
+	}
+	if got := w.written(); got != "flushed closed" {
+		t.Errorf("got %q after Close", got)
+	}
+}
+
+func TestAsyncWriterBatchLargeRecord(t *testing.T) {
+	w := &batchWriter{}
+	aw := NewAsyncWriterV2(w, 16, 1)
+	aw.SetBatching(8, time.Millisecond)
+
+	aw.Write([]byte("a"))
+	aw.Write([]byte("larger than a batch"))
+	aw.Write([]byte("b"))
+	aw.Close()
+
+	if w.data.String() != "alarger than a batchb" {
+		t.Errorf("got %q", w.data.String())
+	}
+}
+
+func TestAsyncWriterBatchConn(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		b, _ := io.ReadAll(c)
+		received <- string(b)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	aw := NewAsyncWriterV2(conn, 64, 1)
+	aw.SetBatching(4096, time.Millisecond)
+
+	var want strings.Builder
+	for i := 0; i < 100; i++ {
+		record := fmt.Sprintf("record %d\n", i)
+		want.WriteString(record)
+		aw.Write([]byte(record))
+	}
+	aw.Close()
+
+	if got := <-received; got != want.String() {
+		t.Errorf("connection received %q", got)
+	}
+}
+
+func TestAsyncWriterBatchDecoding(t *testing.T) {
+	var out bytes.Buffer
+	aw := NewAsyncWriterV2(NewJSONWriter(&out), 64, 2)
+	aw.SetOrdered(true)
+	aw.SetBatching(4096, time.Millisecond)
+
+	logger := NewStructured()
+	logger.SetWriter(aw)
+	for i := 0; i < 50; i++ {
+		logger.Info("request", Int("i", i))
+	}
+	aw.Close()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 50 {
+		t.Fatalf("%d lines", len(lines))
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, fmt.Sprintf(`"msg":"request","i":%d}`, i)) {
+			t.Fatalf("line %d: %s", i, line)
+		}
+	}
+}
+
+func BenchmarkAsyncWriterDelivery(b *testing.B) {
+	record := bytes.Repeat([]byte("x"), 128)
+	for _, mode := range []struct {
+		name    string
+		ordered bool
+		batch   int
+	}{
+		{"Unordered", false, 0},
+		{"Ordered", true, 0},
+		{"Batched", false, 64 << 10},
+		{"OrderedBatched", true, 64 << 10},
+	} {
+		b.Run(mode.name, func(b *testing.B) {
+			aw := NewAsyncWriterV2(io.Discard, 1024, 2)
+			aw.SetOrdered(mode.ordered)
+			aw.SetBatching(mode.batch, 100*time.Microsecond)
+			defer aw.Close()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				aw.Write(record)
+			}
+			aw.Flush(context.Background())
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package zlog
+
+import (
+	"runtime"
+	"time"
+)
+
+// idleSpins is the number of times an IdleSpinPark worker yields before
+// it parks
+const idleSpins = 64
+
+// IdleStrategy selects how AsyncWriterV2 workers wait while the ring
+// buffer is empty
+type IdleStrategy int32
+
+const (
+	IdleSpinPark IdleStrategy = iota // Yield a few times, then sleep until a record arrives
+	IdleBlock                        // Sleep until a record arrives
+	IdleBusySpin                     // Poll without sleeping; lowest latency, a CPU per worker
+)
+
+// SetIdleStrategy sets how workers wait for records. The default,
+// IdleSpinPark, uses no CPU while the writer is idle and keeps workers
+// awake through short gaps between records. It can be changed while the
+// writer is in use.
+func (aw *AsyncWriterV2) SetIdleStrategy(strategy IdleStrategy) {
+	aw.idle.Store(int32(strategy))
+	aw.wakeAll() // Parked workers pick up the new strategy
+}
+
+// wait waits for records after polls consecutive empty polls of the ring
+// buffer
+//
+//go:inline
+func (aw *AsyncWriterV2) wait(polls int) {
+	switch IdleStrategy(aw.idle.Load()) {
+	case IdleBusySpin:
+		// Poll again at once
+	case IdleBlock:
+		aw.park(noTimeout, false)
+	default:
+		if polls < idleSpins {
+			runtime.Gosched()
+		} else {
+			aw.park(noTimeout, false)
+		}
+	}
+}
+
+// noTimeout makes park wait without a timeout
+const noTimeout time.Duration = -1
+
+// park sleeps until a producer signals a record, Close, the next drop
+// summary is due or timeout has passed. A worker holding a partial batch
+// sets batch, and is also woken by Flush.
+func (aw *AsyncWriterV2) park(timeout time.Duration, batch bool) {
+	if timeout != noTimeout && timeout <= 0 {
+		return
+	}
+	aw.sleepers.Add(1)
+	defer aw.sleepers.Add(-1)
+
+	// A producer that put a record, or a SetIdleStrategy or Flush call,
+	// before sleepers was raised did not signal it
+	if !aw.rb.empty() || aw.stop.Load() || IdleStrategy(aw.idle.Load()) == IdleBusySpin ||
+		batch && aw.flushing.Load() != 0 {
+		return
+	}
+
+	if aw.unreportedTotal.Load() != 0 && aw.summaryInterval > 0 && (timeout == noTimeout || aw.summaryInterval < timeout) {
+		timeout = aw.summaryInterval
+	}
+	var expired <-chan time.Time
+	if timeout != noTimeout {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case <-aw.wake:
+	case <-aw.stopped:
+	case <-expired:
+	}
+}
+
+// notify wakes a parked worker. The signal is dropped if every worker
+// already has one pending.
+//
+//go:inline
+func (aw *AsyncWriterV2) notify() {
+	select {
+	case aw.wake <- struct{}{}:
+	default:
+	}
+}
+
+// wakeAll wakes every parked worker
+func (aw *AsyncWriterV2) wakeAll() {
+	for n := aw.sleepers.Load(); n > 0; n-- {
+		aw.notify()
+	}
+}
@@ -0,0 +1,109 @@
+package zlog
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+var idleStrategies = []struct {
+	name     string
+	strategy IdleStrategy
+}{
+	{"SpinPark", IdleSpinPark},
+	{"Block", IdleBlock},
+	{"BusySpin", IdleBusySpin},
+}
+
+func TestAsyncWriterIdleStrategies(t *testing.T) {
+	for _, tt := range idleStrategies {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &slowWriter{}
+			aw := NewAsyncWriterV2(w, 16, 2)
+			aw.SetIdleStrategy(tt.strategy)
+
+			for i := 0; i < 50; i++ {
+				aw.Write([]byte("record"))
+				if i%10 == 0 {
+					time.Sleep(time.Millisecond) // Let the workers go idle
+				}
+			}
+			if err := aw.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if n := w.len(); n != 50 {
+				t.Errorf("%d of 50 records written", n)
+			}
+			aw.Close()
+		})
+	}
+}
+
+func TestAsyncWriterWorkersPark(t *testing.T) {
+	const workers = 4
+	aw := NewAsyncWriterV2(io.Discard, 16, workers)
+	defer aw.Close()
+
+	waitSleepers := func(want int32) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for aw.sleepers.Load() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d workers parked, want %d", aw.sleepers.Load(), want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitSleepers(workers)
+
+	aw.SetIdleStrategy(IdleBusySpin)
+	waitSleepers(0)
+
+	aw.SetIdleStrategy(IdleBlock)
+	waitSleepers(workers)
+}
+
+// latencyWriter records the time from the enqueue timestamp in each record
+// to its write
+type latencyWriter struct {
+	mu        sync.Mutex
+	latencies []int64
+}
+
+func (w *latencyWriter) Write(p []byte) (int, error) {
+	latency := nanotime() - int64(binary.LittleEndian.Uint64(p))
+	w.mu.Lock()
+	w.latencies = append(w.latencies, latency)
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+// BenchmarkAsyncWriterLatency reports the 99th percentile of the time from
+// Write to the underlying writer, for records spaced so that workers go
+// idle between them
+func BenchmarkAsyncWriterLatency(b *testing.B) {
+	for _, tt := range idleStrategies {
+		b.Run(tt.name, func(b *testing.B) {
+			w := &latencyWriter{}
+			aw := NewAsyncWriterV2(w, 1024, 1)
+			aw.SetIdleStrategy(tt.strategy)
+
+			var record [8]byte
+			for i := 0; i < b.N; i++ {
+				binary.LittleEndian.PutUint64(record[:], uint64(nanotime()))
+				aw.Write(record[:])
+				time.Sleep(20 * time.Microsecond)
+			}
+			aw.Close()
+
+			slices.Sort(w.latencies)
+			if len(w.latencies) > 0 {
+				b.ReportMetric(float64(w.latencies[len(w.latencies)*99/100]), "p99-ns")
+			}
+		})
+	}
+}
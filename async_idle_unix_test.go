@@ -0,0 +1,39 @@
+//go:build !windows
+
+package zlog
+
+import (
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// processCPU returns the CPU time used by the process so far, in seconds
+func processCPU(b *testing.B) float64 {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		b.Fatal(err)
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()).Seconds()
+}
+
+// BenchmarkAsyncWriterIdle reports the CPU used by the workers of an idle
+// writer, in CPU seconds per second
+func BenchmarkAsyncWriterIdle(b *testing.B) {
+	for _, tt := range idleStrategies {
+		b.Run(tt.name, func(b *testing.B) {
+			aw := NewAsyncWriterV2(io.Discard, 1024, 1)
+			aw.SetIdleStrategy(tt.strategy)
+			defer aw.Close()
+			time.Sleep(time.Millisecond) // Let the workers settle
+
+			cpu := processCPU(b)
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				time.Sleep(100 * time.Microsecond)
+			}
+			b.ReportMetric((processCPU(b)-cpu)/time.Since(start).Seconds(), "cpu-s/s")
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"runtime"
+	"time"
+)
+
+// defaultDropSummaryInterval is the minimum time between two summaries of
+// dropped records
+const defaultDropSummaryInterval = 10 * time.Second
+
+// OverflowPolicy selects what AsyncWriterV2.Write does when the ring buffer
+// is full
+type OverflowPolicy int
+
+const (
+	OverflowSpill      OverflowPolicy = iota // Write queued records synchronously to make room
+	OverflowBlock                            // Wait until a worker makes room
+	OverflowDropNewest                       // Drop the record being written
+	OverflowDropOldest                       // Drop the oldest queued record to make room
+	OverflowDropBelow                        // Drop records below the drop level, spill the others
+)
+
+// SetOverflowPolicy sets what Write does when the ring buffer is full.
+// The default, OverflowSpill, never loses records but makes the logging
+// goroutine wait for the underlying writer. Set it before the writer is in
+// use.
+func (aw *AsyncWriterV2) SetOverflowPolicy(policy OverflowPolicy) {
+	aw.overflow = policy
+}
+
+// SetDropLevel sets the level below which OverflowDropBelow drops records.
+// Set it before the writer is in use.
+func (aw *AsyncWriterV2) SetDropLevel(level Level) {
+	aw.dropLevel = level
+}
+
+// SetDropSummaryInterval sets the minimum time between the records that
+// report how many records were dropped, by level. The summary is written
+// at LevelWarn to the underlying writer, in the format of the dropped
+// records; 0 disables it. Set it before the writer is in use.
+func (aw *AsyncWriterV2) SetDropSummaryInterval(d time.Duration) {
+	aw.summaryInterval = d
+}
+
+// Dropped returns the number of records at level dropped since the writer
+// was created. Records that are not written by a zlog logger count as
+// LevelInfo.
+func (aw *AsyncWriterV2) Dropped(level Level) uint64 {
+	if level > LevelFatal {
+		return 0
+	}
+	return aw.dropped[level].Load()
+}
+
+// overflowed handles a full ring buffer for entry according to the
+// overflow policy. It returns false if entry was dropped instead of
+// queued.
+func (aw *AsyncWriterV2) overflowed(entry *LogEntry) bool {
+	switch aw.overflow {
+	case OverflowBlock:
+		runtime.Gosched()
+	case OverflowDropNewest:
+		aw.drop(entry)
+		return false
+	case OverflowDropOldest:
+		if oldest, ok := aw.rb.Get(); ok {
+			aw.drop(oldest)
+		}
+	case OverflowDropBelow:
+		if recordLevel(entry.data) < aw.dropLevel {
+			aw.drop(entry)
+			return false
+		}
+		aw.spill()
+	default:
+		aw.spill()
+	}
+	return true
+}
+
+// spill writes a queued entry on the calling goroutine to make room
+func (aw *AsyncWriterV2) spill() {
+	if aw.ordered.Load() {
+		aw.consumer.Lock()
+		defer aw.consumer.Unlock()
+	}
+	if consumed, ok := aw.rb.Get(); ok {
+		aw.write(consumed)
+	} else {
+		runtime.Gosched()
+	}
+}
+
+// drop counts and recycles an entry that will not be written
+func (aw *AsyncWriterV2) drop(entry *LogEntry) {
+	level := recordLevel(entry.data)
+	aw.dropped[level].Add(1)
+	aw.unreported[level].Add(1)
+	aw.dropFormat.Store(int32(recordFormat(entry.data)))
+	aw.unreportedTotal.Add(1)
+
+	aw.pending[entry.gen].Add(-1)
+	entry.data = entry.data[:0]
+	aw.pool.Put(entry)
+}
+
+// maybeWriteDropSummary writes a summary of the records dropped since the
+// last one if the summary interval has passed
+func (aw *AsyncWriterV2) maybeWriteDropSummary() {
+	if aw.summaryInterval <= 0 {
+		return
+	}
+	now := nanotime()
+	last := aw.lastSummary.Load()
+	if now-last < int64(aw.summaryInterval) || !aw.lastSummary.CompareAndSwap(last, now) {
+		return
+	}
+	aw.writeDropSummary()
+}
+
+// writeDropSummary writes a LevelWarn record with the number of records
+// dropped since the last summary, in total and for each level. With
+// SetOrdered, it waits its turn like a worker.
+func (aw *AsyncWriterV2) writeDropSummary() {
+	if aw.ordered.Load() {
+		aw.consumer.Lock()
+		defer aw.consumer.Unlock()
+	}
+
+	var counts [LevelFatal + 1]uint64
+	var total uint64
+	for level := range counts {
+		counts[level] = aw.unreported[level].Swap(0)
+		total += counts[level]
+	}
+	if total == 0 {
+		return
+	}
+	aw.unreportedTotal.Add(-int64(total))
+
+	fields := make([]Field, 0, len(counts)+1)
+	fields = append(fields, Uint64("dropped", total))
+	for level, n := range counts {
+		if n > 0 {
+			fields = append(fields, Uint64(getLevelString(Level(level)), n))
+		}
+	}
+
+	l := NewStructured()
+	l.SetFormat(LogFormat(aw.dropFormat.Load()))
+	l.SetWriter(aw.writer)
+	l.Warn("records dropped", fields...)
+}
+
+// recordLevel returns the level of a record written by a logger in any
+// format, or LevelInfo if it has none
+func recordLevel(b []byte) Level {
+	if len(b) >= recordHeaderSize && binary.LittleEndian.Uint32(b) == MagicHeader {
+		if level := Level(b[5]); level <= LevelFatal {
+			return level
+		}
+		return LevelInfo
+	}
+
+	// The level is in the first keys of JSON and logfmt lines
+	head := b[:min(len(b), 64)]
+	var name []byte
+	if i := bytes.Index(head, []byte(`"level":"`)); i >= 0 {
+		name = head[i+len(`"level":"`):]
+	} else if i := bytes.Index(head, []byte("level=")); i >= 0 {
+		name = head[i+len("level="):]
+	}
+	for level := LevelDebug; level <= LevelFatal; level++ {
+		if bytes.HasPrefix(name, []byte(getLevelString(level))) {
+			return level
+		}
+	}
+	return LevelInfo
+}
+
+// recordFormat returns the format of a record
+func recordFormat(b []byte) LogFormat {
+	switch {
+	case len(b) >= recordHeaderSize && binary.LittleEndian.Uint32(b) == MagicHeader:
+		return FormatBinary
+	case len(b) > 0 && b[0] == '{':
+		return FormatJSON
+	default:
+		return FormatText
+	}
+}
@@ -0,0 +1,253 @@
+package zlog
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gateWriter blocks every write until the gate is opened, and signals the
+// first write on entered
+type gateWriter struct {
+	gate    chan struct{}
+	entered chan struct{}
+	once    sync.Once
+	writes  atomic.Int32 // Writes started
+	mu      sync.Mutex
+	out     bytes.Buffer
+}
+
+func newGateWriter() *gateWriter {
+	return &gateWriter{gate: make(chan struct{}), entered: make(chan struct{})}
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	w.writes.Add(1)
+	w.once.Do(func() { close(w.entered) })
+	<-w.gate
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.out.Write(p)
+}
+
+func (w *gateWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.out.String()
+}
+
+// newOverflowLogger returns a JSON logger writing to an async writer with
+// a ring of 4 entries whose single worker is stuck in the gate writer
+func newOverflowLogger(t *testing.T, policy OverflowPolicy) (*StructuredLogger, *AsyncWriterV2, *gateWriter) {
+	t.Helper()
+	w := newGateWriter()
+	aw := NewAsyncWriterV2(w, 4, 1)
+	aw.SetOverflowPolicy(policy)
+
+	logger := NewStructured()
+	logger.SetFormat(FormatJSON)
+	logger.SetLevel(LevelDebug)
+	logger.SetWriter(aw)
+	logger.Info("stuck", Int("i", -1))
+	<-w.entered
+	return logger, aw, w
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	logger, aw, w := newOverflowLogger(t, OverflowDropNewest)
+	for i := 0; i < 10; i++ {
+		logger.Info("m", Int("i", i))
+	}
+	if n := aw.Dropped(LevelInfo); n != 6 {
+		t.Errorf("Dropped(LevelInfo) = %d, want 6", n)
+	}
+
+	close(w.gate)
+	aw.Close()
+	out := w.String()
+	if !strings.Contains(out, `"i":3}`) || strings.Contains(out, `"i":4}`) {
+		t.Errorf("expected records 0 to 3, got %s", out)
+	}
+	if !strings.Contains(out, `"level":"warn"`) || !strings.HasSuffix(out, `"msg":"records dropped","dropped":6,"info":6}`+"\n") {
+		t.Errorf("missing drop summary: %s", out)
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	logger, aw, w := newOverflowLogger(t, OverflowDropOldest)
+	for i := 0; i < 10; i++ {
+		logger.Warn("m", Int("i", i))
+	}
+	if n := aw.Dropped(LevelWarn); n != 6 {
+		t.Errorf("Dropped(LevelWarn) = %d, want 6", n)
+	}
+
+	close(w.gate)
+	aw.Close()
+	out := w.String()
+	if strings.Contains(out, `"i":5}`) || !strings.Contains(out, `"i":6}`) || !strings.Contains(out, `"i":9}`) {
+		t.Errorf("expected records 6 to 9, got %s", out)
+	}
+}
+
+func TestOverflowDropBelow(t *testing.T) {
+	logger, aw, w := newOverflowLogger(t, OverflowDropBelow)
+	aw.SetDropLevel(LevelWarn)
+	for i := 0; i < 4; i++ {
+		logger.Info("queued")
+	}
+	logger.Debug("dropped")
+	logger.Info("dropped")
+
+	done := make(chan struct{})
+	go func() {
+		logger.Error("kept")
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("error record dropped instead of spilled")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(w.gate)
+	<-done
+	aw.Close()
+	if aw.Dropped(LevelDebug) != 1 || aw.Dropped(LevelInfo) != 1 || aw.Dropped(LevelError) != 0 {
+		t.Errorf("dropped %d debug, %d info, %d error", aw.Dropped(LevelDebug), aw.Dropped(LevelInfo), aw.Dropped(LevelError))
+	}
+	if out := w.String(); !strings.Contains(out, `"msg":"kept"`) || strings.Contains(out, `"msg":"dropped"`) {
+		t.Errorf("unexpected output %s", out)
+	}
+}
+
+func TestOverflowBlock(t *testing.T) {
+	logger, aw, w := newOverflowLogger(t, OverflowBlock)
+	for i := 0; i < 4; i++ {
+		logger.Info("queued")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		logger.Info("blocked")
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("write did not block on a full ring")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(w.gate)
+	<-done
+	aw.Close()
+	if n := strings.Count(w.String(), "\n"); n != 6 {
+		t.Errorf("%d records written, want 6", n)
+	}
+}
+
+func TestOverflowSummaryInterval(t *testing.T) {
+	logger, aw, w := newOverflowLogger(t, OverflowDropNewest)
+	aw.SetDropSummaryInterval(time.Millisecond)
+	for i := 0; i < 6; i++ {
+		logger.Debug("m")
+	}
+	close(w.gate)
+
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(w.String(), `"msg":"records dropped","dropped":2,"debug":2}`) {
+		if time.Now().After(deadline) {
+			t.Fatalf("no summary before Close: %s", w.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	aw.Close()
+	if n := strings.Count(w.String(), "records dropped"); n != 1 {
+		t.Errorf("%d summaries written", n)
+	}
+}
+
+func TestOverflowSummaryOrdered(t *testing.T) {
+	w := newGateWriter()
+	aw := NewAsyncWriterV2(w, 4, 1)
+	aw.SetOrdered(true)
+	aw.SetOverflowPolicy(OverflowDropNewest)
+	aw.SetDropSummaryInterval(time.Millisecond)
+	logger := NewStructured()
+	logger.SetFormat(FormatJSON)
+	logger.SetLevel(LevelDebug)
+	logger.SetWriter(aw)
+
+	logger.Info("stuck")
+	<-w.entered
+	for i := 0; i < 6; i++ {
+		logger.Debug("m")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		aw.writeDropSummary()
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if n := w.writes.Load(); n != 1 {
+		t.Errorf("%d writes started, the summary did not wait for the write in progress", n)
+	}
+
+	close(w.gate)
+	<-done
+	aw.Close()
+	if n := strings.Count(w.String(), `"msg":"records dropped","dropped":2,"debug":2}`); n != 1 {
+		t.Errorf("%d summaries written: %s", n, w.String())
+	}
+}
+
+func TestOverflowBinarySummary(t *testing.T) {
+	w := newGateWriter()
+	aw := NewAsyncWriterV2(w, 4, 1)
+	aw.SetOverflowPolicy(OverflowDropNewest)
+	logger := NewStructured()
+	logger.SetWriter(aw)
+
+	logger.Info("stuck")
+	<-w.entered
+	for i := 0; i < 5; i++ {
+		logger.Error("m")
+	}
+	close(w.gate)
+	aw.Close()
+
+	var rec Record
+	b := []byte(w.String())
+	for len(b) > 0 {
+		n, err := DecodeRecord(b, &rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = b[n:]
+	}
+	if rec.Level != LevelWarn || string(rec.Message) != "records dropped" {
+		t.Errorf("last record is %v %q", rec.Level, rec.Message)
+	}
+}
+
+func TestRecordLevel(t *testing.T) {
+	tests := []struct {
+		record string
+		level  Level
+	}{
+		{`{"time":"2024-03-01T12:00:00Z","level":"error","msg":"m"}`, LevelError},
+		{`time=2024-03-01T12:00:00Z level=debug msg=m`, LevelDebug},
+		{`{"msg":"level=warn"}`, LevelWarn},
+		{`plain text`, LevelInfo},
+	}
+	for _, tt := range tests {
+		if got := recordLevel([]byte(tt.record)); got != tt.level {
+			t.Errorf("recordLevel(%s) = %v, want %v", tt.record, got, tt.level)
+		}
+	}
+}
@@ -1,83 +1,119 @@
 package zlog
 
 import (
+	"context"
 	"io"
 	"runtime"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
-// RingBuffer[T] is a generic lock-free ring buffer optimized for Go 1.23+
+// RingBuffer[T] is a generic lock-free ring buffer optimized for Go 1.23+.
+// It is a bounded multi-producer, multi-consumer queue: every slot carries
+// a sequence number telling producers and consumers whose turn it is, so
+// any number of goroutines can call Put and Get concurrently.
 type RingBuffer[T any] struct {
-	_      [CacheLineSize]byte // Padding
-	mask   uint64              // Size mask for fast modulo
-	_      [56]byte            // Padding to cache line
-	head   atomic.Uint64       // Producer position
-	_      [56]byte            // Padding to cache line
-	tail   atomic.Uint64       // Consumer position
-	_      [56]byte            // Padding to cache line
-	buffer []atomic.Pointer[T] // Buffer of atomic pointers
-	pool   *Pool[*T]           // Object pool for entries
-}
-
-// NewRingBuffer creates a new generic ring buffer
+	_     [CacheLineSize]byte // Padding
+	mask  uint64              // Size mask for fast modulo
+	_     [56]byte            // Padding to cache line
+	head  atomic.Uint64       // Producer position
+	_     [56]byte            // Padding to cache line
+	tail  atomic.Uint64       // Consumer position
+	_     [56]byte            // Padding to cache line
+	slots []ringSlot[T]       // Buffer of sequenced slots
+	pool  *Pool[*T]           // Object pool for entries
+}
+
+// ringSlot is a slot of a RingBuffer. A slot at position pos is free for
+// the producer of pos when seq == pos, and holds the item for the consumer
+// of pos when seq == pos+1.
+type ringSlot[T any] struct {
+	seq  atomic.Uint64
+	item *T
+}
+
+// NewRingBuffer creates a new generic ring buffer holding up to size
+// items, rounded up to a power of 2
 func NewRingBuffer[T any](size int, pool *Pool[*T]) *RingBuffer[T] {
 	// Ensure size is power of 2
 	size = nextPowerOf2(size)
 
 	rb := &RingBuffer[T]{
-		buffer: make([]atomic.Pointer[T], size),
-		mask:   uint64(size - 1),
-		pool:   pool,
+		slots: make([]ringSlot[T], size),
+		mask:  uint64(size - 1),
+		pool:  pool,
+	}
+	for i := range rb.slots {
+		rb.slots[i].seq.Store(uint64(i))
 	}
 
 	return rb
 }
 
-// Put adds an item to the ring buffer (wait-free for single producer)
+// Put adds an item to the ring buffer. It returns false if the buffer is
+// full. Safe for concurrent producers (lock-free).
 //
 //go:inline
 func (rb *RingBuffer[T]) Put(item *T) bool {
-	head := rb.head.Load()
-	next := (head + 1) & rb.mask
+	pos := rb.head.Load()
+	for {
+		slot := &rb.slots[pos&rb.mask]
+		seq := slot.seq.Load()
 
-	// Check if full
-	if next == rb.tail.Load() {
-		return false
+		switch diff := int64(seq - pos); {
+		case diff == 0:
+			// The slot is free; claim the position
+			if rb.head.CompareAndSwap(pos, pos+1) {
+				slot.item = item
+				slot.seq.Store(pos + 1) // Publish to the consumer
+				return true
+			}
+			pos = rb.head.Load()
+		case diff < 0:
+			// The slot still holds the item of the previous lap
+			return false
+		default:
+			// Another producer claimed pos
+			pos = rb.head.Load()
+		}
 	}
+}
 
-	// Store item
-	rb.buffer[head].Store(item)
-
-	// Update head (this is the linearization point)
-	rb.head.Store(next)
-	return true
+// empty reports whether no item is ready for the next Get
+//
+//go:inline
+func (rb *RingBuffer[T]) empty() bool {
+	pos := rb.tail.Load()
+	return rb.slots[pos&rb.mask].seq.Load() != pos+1
 }
 
-// Get retrieves an item from the ring buffer (lock-free for multiple consumers)
+// Get retrieves an item from the ring buffer. It returns false if the
+// buffer is empty. Safe for concurrent consumers (lock-free).
 //
 //go:inline
 func (rb *RingBuffer[T]) Get() (*T, bool) {
+	pos := rb.tail.Load()
 	for {
-		tail := rb.tail.Load()
-		head := rb.head.Load()
+		slot := &rb.slots[pos&rb.mask]
+		seq := slot.seq.Load()
 
-		// Empty?
-		if tail == head {
-			return nil, false
-		}
-
-		// Try to claim this slot
-		next := (tail + 1) & rb.mask
-		if rb.tail.CompareAndSwap(tail, next) {
-			// Wait for data to be available (should be immediate)
-			for {
-				if item := rb.buffer[tail].Load(); item != nil {
-					// Clear slot for reuse
-					rb.buffer[tail].Store(nil)
-					return item, true
-				}
-				runtime.Gosched()
+		switch diff := int64(seq - (pos + 1)); {
+		case diff == 0:
+			// The slot holds an item; claim the position
+			if rb.tail.CompareAndSwap(pos, pos+1) {
+				item := slot.item
+				slot.item = nil
+				slot.seq.Store(pos + rb.mask + 1) // Free for the next lap
+				return item, true
 			}
+			pos = rb.tail.Load()
+		case diff < 0:
+			// Nothing published at pos yet
+			return nil, false
+		default:
+			// Another consumer claimed pos
+			pos = rb.tail.Load()
 		}
 	}
 }
@@ -85,15 +121,52 @@ func (rb *RingBuffer[T]) Get() (*T, bool) {
 // LogEntry represents a log entry with zero-copy data
 type LogEntry struct {
 	data []byte // Reference to original data
+	gen  uint32 // Flush generation, see AsyncWriterV2.Flush
 }
 
+// flushPollMax bounds the interval at which Flush checks for progress
+const flushPollMax = time.Millisecond
+
 // AsyncWriterV2 is a modern async writer using generic ring buffer
 type AsyncWriterV2 struct {
 	rb      *RingBuffer[LogEntry]
 	writer  io.Writer
-	done    atomic.Bool
+	done    atomic.Bool // Writes are rejected
+	stop    atomic.Bool // Workers exit once the ring is empty
 	pool    *Pool[*LogEntry]
 	workers int
+	wg      sync.WaitGroup
+
+	// Idle workers, see SetIdleStrategy
+	idle     atomic.Int32
+	sleepers atomic.Int32
+	wake     chan struct{}
+	stopped  chan struct{}
+
+	// Delivery, see SetOrdered and SetBatching
+	ordered      atomic.Bool
+	consumer     sync.Mutex // Held while consuming in order
+	batchBytes   atomic.Int64
+	batchLatency atomic.Int64
+
+	// Entries accepted but not yet written, by flush generation
+	gen      atomic.Uint32
+	pending  [2]atomic.Int64
+	flushMu  sync.Mutex
+	flushing atomic.Int32 // Flush calls in progress; partial batches are written at once
+
+	closeOnce sync.Once
+	closeErr  error
+
+	// Overflow handling, see SetOverflowPolicy
+	overflow        OverflowPolicy
+	dropLevel       Level
+	dropped         [LevelFatal + 1]atomic.Uint64
+	unreported      [LevelFatal + 1]atomic.Uint64 // Dropped since the last summary
+	unreportedTotal atomic.Int64
+	dropFormat      atomic.Int32
+	summaryInterval time.Duration
+	lastSummary     atomic.Int64
 }
 
 // NewAsyncWriterV2 creates a new async writer with multiple workers
@@ -104,13 +177,18 @@ func NewAsyncWriterV2(w io.Writer, bufferSize, workers int) *AsyncWriterV2 {
 	})
 
 	aw := &AsyncWriterV2{
-		rb:      NewRingBuffer(bufferSize, pool),
-		writer:  w,
-		pool:    pool,
-		workers: workers,
+		rb:              NewRingBuffer(bufferSize, pool),
+		writer:          w,
+		pool:            pool,
+		workers:         workers,
+		summaryInterval: defaultDropSummaryInterval,
+		wake:            make(chan struct{}, workers),
+		stopped:         make(chan struct{}),
 	}
+	aw.lastSummary.Store(nanotime())
 
 	// Start workers
+	aw.wg.Add(workers)
 	for i := 0; i < workers; i++ {
 		go aw.worker()
 	}
@@ -118,10 +196,22 @@ func NewAsyncWriterV2(w io.Writer, bufferSize, workers int) *AsyncWriterV2 {
 	return aw
 }
 
-// Write adds data to the async writer (zero-copy)
+// Write adds data to the async writer. It fails with io.ErrClosedPipe
+// once Close was called. If the ring buffer is full, the overflow policy
+// decides whether it waits or drops a record.
 func (aw *AsyncWriterV2) Write(b []byte) (int, error) {
+	// Count the entry before checking done, so Close either sees it or
+	// this write sees done
+	gen := aw.gen.Load() & 1
+	aw.pending[gen].Add(1)
+	if aw.done.Load() {
+		aw.pending[gen].Add(-1)
+		return 0, io.ErrClosedPipe
+	}
+
 	// Get entry from pool
 	entry := aw.pool.Get()
+	entry.gen = gen
 
 	// Copy data to avoid lifetime issues
 	if cap(entry.data) < len(b) {
@@ -133,53 +223,100 @@ func (aw *AsyncWriterV2) Write(b []byte) (int, error) {
 
 	// Try to put in ring buffer
 	for !aw.rb.Put(entry) {
-		if aw.done.Load() {
-			aw.pool.Put(entry)
-			return 0, io.ErrClosedPipe
-		}
-
-		// Backpressure - help consume
-		if consumed, ok := aw.rb.Get(); ok {
-			aw.writer.Write(consumed.data)
-			consumed.data = consumed.data[:0]
-			aw.pool.Put(consumed)
-		} else {
-			runtime.Gosched()
+		if !aw.overflowed(entry) {
+			return len(b), nil
 		}
 	}
+	if aw.sleepers.Load() != 0 {
+		aw.notify()
+	}
 
 	return len(b), nil
 }
 
-// worker processes entries from the ring buffer
+// write writes an entry to the underlying writer and recycles it
+//
+//go:inline
+func (aw *AsyncWriterV2) write(entry *LogEntry) {
+	aw.writer.Write(entry.data)
+	aw.pending[entry.gen].Add(-1)
+	entry.data = entry.data[:0]
+	aw.pool.Put(entry)
+}
+
+// worker processes entries from the ring buffer until Close
 func (aw *AsyncWriterV2) worker() {
-	for !aw.done.Load() {
-		entry, ok := aw.rb.Get()
-		if ok {
-			aw.writer.Write(entry.data)
-			entry.data = entry.data[:0]
-			aw.pool.Put(entry)
-		} else {
-			runtime.Gosched()
+	defer aw.wg.Done()
+	var b batch
+	polls := 0 // Consecutive empty polls
+	for {
+		if aw.unreportedTotal.Load() != 0 {
+			aw.maybeWriteDropSummary()
 		}
+		if aw.consume(&b) {
+			polls = 0
+			continue
+		}
+		if aw.stop.Load() {
+			return
+		}
+		aw.wait(polls)
+		polls++
 	}
+}
 
-	// Drain remaining
-	for {
-		entry, ok := aw.rb.Get()
-		if !ok {
-			break
+// Flush blocks until every write that returned before the call has reached
+// the underlying writer, or ctx is done. Writes made during Flush are not
+// waited for.
+func (aw *AsyncWriterV2) Flush(ctx context.Context) error {
+	aw.flushMu.Lock()
+	defer aw.flushMu.Unlock()
+	aw.flushing.Add(1)
+	defer aw.flushing.Add(-1)
+	aw.wakeAll() // Workers waiting to fill a batch write it now
+
+	// Entries of the previous generation are left over by a Flush that
+	// gave up; new writes no longer join them
+	gen := aw.gen.Load()
+	if err := aw.waitWritten(ctx, (gen+1)&1); err != nil {
+		return err
+	}
+	aw.gen.Store(gen + 1)
+	return aw.waitWritten(ctx, gen&1)
+}
+
+// waitWritten waits until all entries of a flush generation are written
+func (aw *AsyncWriterV2) waitWritten(ctx context.Context, gen uint32) error {
+	for wait := time.Microsecond; aw.pending[gen].Load() > 0; wait = min(2*wait, flushPollMax) {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
-		aw.writer.Write(entry.data)
-		entry.data = entry.data[:0]
-		aw.pool.Put(entry)
+		time.Sleep(wait)
 	}
+	return nil
 }
 
-// Close stops the async writer
+// Close stops accepting writes, waits until every accepted write has
+// reached the underlying writer and stops the workers. Records dropped
+// since the last summary are reported, unless summaries are disabled. The
+// underlying writer is closed if it is an io.Closer, and its error
+// returned. Calling Close again returns the same error.
 func (aw *AsyncWriterV2) Close() error {
-	aw.done.Store(true)
-	return nil
+	aw.closeOnce.Do(func() {
+		aw.done.Store(true)
+		aw.Flush(context.Background())
+		aw.stop.Store(true)
+		close(aw.stopped)
+		aw.wg.Wait()
+		if aw.summaryInterval > 0 {
+			aw.writeDropSummary()
+		}
+
+		if c, ok := aw.writer.(io.Closer); ok {
+			aw.closeErr = c.Close()
+		}
+	})
+	return aw.closeErr
 }
 
 // nextPowerOf2 returns the next power of 2 greater than or equal to n
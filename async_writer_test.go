@@ -0,0 +1,199 @@
+package zlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowWriter records what is written to it, taking delay per write
+type slowWriter struct {
+	mu      sync.Mutex
+	delay   time.Duration
+	records []string
+	closed  int
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	w.mu.Lock()
+	w.records = append(w.records, string(p))
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+func (w *slowWriter) Close() error {
+	w.mu.Lock()
+	w.closed++
+	w.mu.Unlock()
+	return errors.New("closed")
+}
+
+func (w *slowWriter) len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.records)
+}
+
+func TestAsyncWriterFlush(t *testing.T) {
+	w := &slowWriter{delay: 50 * time.Microsecond}
+	aw := NewAsyncWriterV2(w, 64, 4)
+	defer aw.Close()
+
+	for round := 1; round <= 3; round++ {
+		for i := 0; i < 100; i++ {
+			aw.Write([]byte("record"))
+		}
+		if err := aw.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if n := w.len(); n != 100*round {
+			t.Fatalf("round %d: %d records written after Flush", round, n)
+		}
+	}
+}
+
+func TestAsyncWriterFlushContext(t *testing.T) {
+	unblock := make(chan struct{})
+	w := &testCapture{fn: func([]byte) error {
+		<-unblock
+		return nil
+	}}
+	aw := NewAsyncWriterV2(w, 16, 1)
+	aw.Write([]byte("blocked"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := aw.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Flush returned %v", err)
+	}
+
+	close(unblock)
+	if err := aw.Flush(context.Background()); err != nil {
+		t.Errorf("Flush after unblocking returned %v", err)
+	}
+	aw.Close()
+}
+
+func TestAsyncWriterClose(t *testing.T) {
+	w := &slowWriter{delay: 20 * time.Microsecond}
+	aw := NewAsyncWriterV2(w, 16, 2)
+
+	for i := 0; i < 200; i++ {
+		if _, err := aw.Write([]byte("record")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := aw.Close(); err == nil || err.Error() != "closed" {
+		t.Errorf("Close returned %v, want the writer's error", err)
+	}
+	if n := w.len(); n != 200 {
+		t.Errorf("%d of 200 records written", n)
+	}
+
+	if err := aw.Close(); err == nil || err.Error() != "closed" {
+		t.Errorf("second Close returned %v", err)
+	}
+	if w.closed != 1 {
+		t.Errorf("writer closed %d times", w.closed)
+	}
+	if _, err := aw.Write([]byte("late")); err != io.ErrClosedPipe {
+		t.Errorf("Write after Close returned %v", err)
+	}
+}
+
+// TestRingBufferConcurrent checks that with many producers and consumers
+// every item is received exactly once; run it with -race
+func TestRingBufferConcurrent(t *testing.T) {
+	const producers, consumers, perProducer = 8, 8, 5000
+
+	rb := NewRingBuffer[int](64, nil)
+	items := make([]int, producers*perProducer)
+	seen := make([]atomic.Int32, len(items))
+
+	var produced sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		produced.Add(1)
+		go func() {
+			defer produced.Done()
+			for i := p * perProducer; i < (p+1)*perProducer; i++ {
+				items[i] = i
+				for !rb.Put(&items[i]) {
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+
+	var received atomic.Int64
+	var consumed sync.WaitGroup
+	for c := 0; c < consumers; c++ {
+		consumed.Add(1)
+		go func() {
+			defer consumed.Done()
+			for received.Load() < int64(len(items)) {
+				item, ok := rb.Get()
+				if !ok {
+					runtime.Gosched()
+					continue
+				}
+				seen[*item].Add(1)
+				received.Add(1)
+			}
+		}()
+	}
+	produced.Wait()
+	consumed.Wait()
+
+	for i := range seen {
+		if n := seen[i].Load(); n != 1 {
+			t.Fatalf("item %d received %d times", i, n)
+		}
+	}
+	if _, ok := rb.Get(); ok {
+		t.Error("ring not empty after all items were received")
+	}
+}
+
+// TestAsyncWriterConcurrent writes from many goroutines while the writer
+// is closed; every accepted record must be written exactly once
+func TestAsyncWriterConcurrent(t *testing.T) {
+	const producers, perProducer = 8, 2000
+
+	w := &slowWriter{}
+	aw := NewAsyncWriterV2(w, 32, 4)
+
+	var accepted atomic.Int64
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				if _, err := aw.Write([]byte(fmt.Sprintf("%d-%d", p, i))); err == nil {
+					accepted.Add(1)
+				}
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond)
+	aw.Close()
+	wg.Wait()
+
+	seen := make(map[string]bool, len(w.records))
+	for _, r := range w.records {
+		if seen[r] {
+			t.Fatalf("record %s written twice", r)
+		}
+		seen[r] = true
+	}
+	if int64(len(w.records)) != accepted.Load() {
+		t.Errorf("%d records written, %d accepted", len(w.records), accepted.Load())
+	}
+}
@@ -0,0 +1,118 @@
+package zlog
+
+import "encoding/binary"
+
+// recordAttrs holds the optional attributes captured for one record
+type recordAttrs struct {
+	caller   *callerInfo
+	stack    []byte
+	stackBuf *[]byte // Pooled buffer holding stack, see release
+}
+
+// SetCallerEnabled records the file, line and function of the logging call
+// site with every record. Set it before the logger is shared between
+// goroutines.
+func (l *Logger) SetCallerEnabled(enabled bool) {
+	l.caller = enabled
+}
+
+// SetCallerSkip sets how many extra stack frames to skip when capturing the
+// caller, for helpers that wrap the logger. Set it before the logger is
+// shared between goroutines.
+func (l *Logger) SetCallerSkip(skip int) {
+	l.callerSkip = skip
+}
+
+// attrs captures the enabled per-record attributes. It must be called from
+// the core logging function, directly below the exported method.
+//
+//go:noinline
+func (l *Logger) attrs(level Level) recordAttrs {
+	var a recordAttrs
+	// Above attrs are the core logging function and the exported method
+	if l.caller {
+		a.caller = lookupCaller(3 + l.callerSkip)
+	}
+	if l.stack && level >= l.stackLevel {
+		a.stackBuf = GetBuffer(maxStackSize)
+		a.stack = appendStack((*a.stackBuf)[:0], 3+l.callerSkip)
+	}
+	return a
+}
+
+// attrsAt captures the record attributes for a record whose call site is
+// already known as a program counter, as with log/slog records
+func (l *Logger) attrsAt(level Level, pc uintptr) recordAttrs {
+	var a recordAttrs
+	if l.caller && pc != 0 {
+		a.caller = callerForPC(pc)
+	}
+	if l.stack && level >= l.stackLevel {
+		a.stackBuf = GetBuffer(maxStackSize)
+		a.stack = appendStackFrom((*a.stackBuf)[:0], pc)
+	}
+	return a
+}
+
+// release returns pooled attribute storage once the record is encoded
+//
+//go:inline
+func (a *recordAttrs) release() {
+	if a.stackBuf != nil {
+		*a.stackBuf = a.stack
+		PutBuffer(a.stackBuf)
+		a.stackBuf, a.stack = nil, nil
+	}
+}
+
+// textSize returns the space needed for the attributes in text output
+func (a *recordAttrs) textSize() int {
+	n := 0
+	if a.caller != nil {
+		n += 16 + len(a.caller.text)
+	}
+	if a.stack != nil {
+		n += 16 + 2*len(a.stack) // Newlines and tabs are escaped
+	}
+	return n
+}
+
+// attrSize returns the space needed for the record's attribute sections
+//
+//go:inline
+func (l *Logger) attrSize(a *recordAttrs) int {
+	n := 0
+	if l.monotonic {
+		n += 10
+	}
+	if a.caller != nil {
+		n += 2 + len(a.caller.payload)
+	}
+	if a.stack != nil {
+		n += 2 + len(a.stack)
+	}
+	return n
+}
+
+// writeAttrs writes the enabled attribute sections at pos, which must have
+// attrSize bytes available, and returns the new position and flags.
+// Sections are written in flag bit order.
+func (l *Logger) writeAttrs(buf []byte, pos int, flags RecordFlags, a *recordAttrs) (int, RecordFlags) {
+	if l.monotonic {
+		pos = writeAttrHeader(buf, pos, 8)
+		binary.LittleEndian.PutUint64(buf[pos:], uint64(nanotime()))
+		pos += 8
+		flags |= FlagMonotonic
+	}
+	if a.caller != nil {
+		pos = writeAttrHeader(buf, pos, len(a.caller.payload))
+		pos += copy(buf[pos:], a.caller.payload)
+		flags |= FlagCaller
+	}
+	if a.stack != nil {
+		pos = writeAttrHeader(buf, pos, len(a.stack))
+		pos += copy(buf[pos:], a.stack)
+		flags |= FlagStack
+	}
+	return pos, flags
+}
@@ -108,6 +108,20 @@ func BenchmarkDisabledDebug(b *testing.B) {
 	}
 }
 
+func BenchmarkDisabledLazy(b *testing.B) {
+	logger := NewStructured()
+	logger.SetWriter(io.Discard)
+	logger.SetLevel(LevelInfo) // Debug disabled
+	payload := make([]byte, 4096)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.Debug("this should not be logged",
+			Lazy("dump", func() Field { return String("", string(payload)) }))
+	}
+}
+
 func BenchmarkAsyncWriter(b *testing.B) {
 	aw := NewAsyncWriter(io.Discard, 1024)
 	defer aw.Close()
@@ -1,6 +1,7 @@
 package zlog
 
 import (
+	"math/bits"
 	"sync"
 	"unsafe"
 )
@@ -104,21 +105,7 @@ func (bp *BufferPool) Put(buf *[]byte) {
 //
 //go:inline
 func leadingZeros64(x uint64) int {
-	return len64tab[x>>58] +
-		len64tab[(x>>52)&0x3f] +
-		len64tab[(x>>46)&0x3f] +
-		len64tab[(x>>40)&0x3f] +
-		len64tab[(x>>34)&0x3f] +
-		len64tab[(x>>28)&0x3f] +
-		len64tab[(x>>22)&0x3f] +
-		len64tab[(x>>16)&0x3f]
-}
-
-var len64tab = [64]int{
-	64, 63, 62, 62, 61, 61, 61, 61, 60, 60, 60, 60, 60, 60, 60, 60,
-	59, 59, 59, 59, 59, 59, 59, 59, 59, 59, 59, 59, 59, 59, 59, 59,
-	58, 58, 58, 58, 58, 58, 58, 58, 58, 58, 58, 58, 58, 58, 58, 58,
-	58, 58, 58, 58, 58, 58, 58, 58, 58, 58, 58, 58, 58, 58, 58, 58,
+	return bits.LeadingZeros64(x)
 }
 
 // Global buffer pool instance
@@ -0,0 +1,106 @@
+package zlog
+
+import (
+	"encoding/binary"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// callerTextMax bounds the "file:line" rendering of a call site
+const callerTextMax = 255 + 1 + 10
+
+// callerKey is the logfmt key of the call site
+var callerKey = []byte("caller")
+
+// callerInfo is a resolved call site, cached by program counter
+type callerInfo struct {
+	pc      uintptr
+	payload []byte // Encoded FlagCaller attribute payload
+	text    []byte // "pkg/file.go:123"
+}
+
+// callerCache maps program counters to resolved call sites. Slots are
+// overwritten on collision, so a lookup never blocks or allocates once a
+// call site has been seen.
+var callerCache [1024]atomic.Pointer[callerInfo]
+
+// lookupCaller returns the call site skip frames above the function
+// calling lookupCaller, or nil if the stack is not that deep
+func lookupCaller(skip int) *callerInfo {
+	var pcs [1]uintptr
+	if runtime.Callers(skip+2, pcs[:]) == 0 {
+		return nil
+	}
+	return callerForPC(pcs[0])
+}
+
+// callerForPC returns the call site of a program counter from
+// runtime.Callers
+func callerForPC(pc uintptr) *callerInfo {
+	slot := &callerCache[(pc>>2)%uintptr(len(callerCache))]
+	if ci := slot.Load(); ci != nil && ci.pc == pc {
+		return ci
+	}
+
+	ci := newCallerInfo(pc)
+	slot.Store(ci)
+	return ci
+}
+
+// newCallerInfo resolves and encodes a call site
+func newCallerInfo(pc uintptr) *callerInfo {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	file := trimCallerPath(frame.File)
+	if len(file) > 255 {
+		file = file[len(file)-255:]
+	}
+
+	// Payload: line (uint32), file length (1), file, function
+	payload := make([]byte, 5, 5+len(file)+len(frame.Function))
+	binary.LittleEndian.PutUint32(payload, uint32(frame.Line))
+	payload[4] = byte(len(file))
+	payload = append(payload, file...)
+	payload = append(payload, frame.Function...)
+
+	text := make([]byte, 0, len(file)+8)
+	text = append(text, file...)
+	text = append(text, ':')
+	text = strconv.AppendInt(text, int64(frame.Line), 10)
+
+	return &callerInfo{pc: pc, payload: payload, text: text}
+}
+
+// trimCallerPath keeps the last directory and the file name
+func trimCallerPath(path string) string {
+	i := strings.LastIndexByte(path, '/')
+	if i < 0 {
+		return path
+	}
+	if j := strings.LastIndexByte(path[:i], '/'); j >= 0 {
+		return path[j+1:]
+	}
+	return path
+}
+
+// Caller returns the call site recorded with FlagCaller
+func (r *Record) Caller() (file []byte, line int, function []byte, ok bool) {
+	a := r.attr(FlagCaller)
+	if len(a) < 5 || 5+int(a[4]) > len(a) {
+		return nil, 0, nil, false
+	}
+	n := 5 + int(a[4])
+	return a[5:n], int(binary.LittleEndian.Uint32(a)), a[n:], true
+}
+
+// appendCaller appends the recorded call site as "file:line"
+func (r *Record) appendCaller(buf []byte) ([]byte, bool) {
+	file, line, _, ok := r.Caller()
+	if !ok {
+		return buf, false
+	}
+	buf = append(buf, file...)
+	buf = append(buf, ':')
+	return strconv.AppendInt(buf, int64(line), 10), true
+}
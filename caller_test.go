@@ -0,0 +1,204 @@
+package zlog
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// nextLine returns "zlog/caller_test.go:<line>" for the line after the
+// one calling it
+func nextLine() string {
+	_, file, line, _ := runtime.Caller(1)
+	return trimCallerPath(file) + ":" + strconv.Itoa(line+1)
+}
+
+func decodeCaller(t *testing.T, b []byte) string {
+	t.Helper()
+	var rec Record
+	if _, err := DecodeRecord(b, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Flags&FlagCaller == 0 {
+		t.Fatal("record has no caller")
+	}
+	file, line, fn, ok := rec.Caller()
+	if !ok {
+		t.Fatal("malformed caller attribute")
+	}
+	if !strings.HasPrefix(string(fn), "github.com/semihalev/zlog/v2.") {
+		t.Errorf("unexpected function %q", fn)
+	}
+	return string(file) + ":" + strconv.Itoa(line)
+}
+
+func TestCaller(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+	logger.SetCallerEnabled(true)
+
+	tests := []struct {
+		name string
+		log  func() string
+	}{
+		{"Logger", func() string {
+			want := nextLine()
+			logger.Logger.Info("x")
+			return want
+		}},
+		{"Structured", func() string {
+			want := nextLine()
+			logger.Warn("x", Int("n", 1))
+			return want
+		}},
+		{"KV", func() string {
+			want := nextLine()
+			logger.ErrorKV("x", "n", 1)
+			return want
+		}},
+		{"With", func() string {
+			want := nextLine()
+			logger.With(String("a", "b")).Info("x")
+			return want
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			want := tt.log()
+			if got := decodeCaller(t, buf.Bytes()); got != want {
+				t.Errorf("caller = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestCallerGlobal(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+	old := Default()
+	SetDefault(logger)
+	defer SetDefault(old)
+	SetCallerEnabled(true)
+
+	want := nextLine()
+	Info("global")
+	if got := decodeCaller(t, buf.Bytes()); got != want {
+		t.Errorf("Info caller = %s, want %s", got, want)
+	}
+
+	buf.Reset()
+	want = nextLine()
+	WarnKV("global", "k", "v")
+	if got := decodeCaller(t, buf.Bytes()); got != want {
+		t.Errorf("WarnKV caller = %s, want %s", got, want)
+	}
+}
+
+// logHelper wraps a logger the way application helpers do
+func logHelper(l *StructuredLogger, msg string) {
+	l.Info(msg)
+}
+
+func TestCallerSkip(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+	logger.SetCallerEnabled(true)
+	logger.SetCallerSkip(1)
+
+	want := nextLine()
+	logHelper(logger, "helped")
+	if got := decodeCaller(t, buf.Bytes()); got != want {
+		t.Errorf("caller = %s, want %s", got, want)
+	}
+}
+
+func TestCallerDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+	logger.Info("x")
+
+	var rec Record
+	if _, err := DecodeRecord(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, ok := rec.Caller(); ok || rec.Flags&FlagCaller != 0 {
+		t.Error("caller recorded while disabled")
+	}
+}
+
+func TestCallerWriters(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		format LogFormat
+		writer func(io.Writer) io.Writer
+		want   string
+	}{
+		{"JSON", FormatJSON, func(w io.Writer) io.Writer { return NewJSONWriter(w) }, `,"caller":"%s"}`},
+		{"Text", FormatText, func(w io.Writer) io.Writer { return NewLogfmtWriter(w) }, ` caller=%s`},
+		{"Terminal", FormatBinary, func(w io.Writer) io.Writer { return NewTerminalWriter(w) }, ` caller=%s`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var decoded, direct bytes.Buffer
+			viaWriter := NewStructured()
+			viaWriter.SetCallerEnabled(true)
+			viaWriter.SetWriter(tt.writer(&decoded))
+			want := strings.Replace(tt.want, "%s", nextLine(), 1)
+			viaWriter.Info("hello", Int("n", 1))
+
+			if !strings.HasSuffix(decoded.String(), want+"\n") {
+				t.Errorf("writer output %q does not end with %q", decoded.String(), want)
+			}
+			if tt.format == FormatBinary {
+				return
+			}
+
+			viaFormat := NewStructured()
+			viaFormat.SetCallerEnabled(true)
+			viaFormat.SetFormat(tt.format)
+			viaFormat.SetWriter(&direct)
+			want = strings.Replace(tt.want, "%s", nextLine(), 1)
+			viaFormat.Info("hello", Int("n", 1))
+
+			if !strings.HasSuffix(direct.String(), want+"\n") {
+				t.Errorf("direct output %q does not end with %q", direct.String(), want)
+			}
+		})
+	}
+}
+
+func TestCallerZeroAlloc(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful under the race detector")
+	}
+	logger := NewStructured()
+	logger.SetWriter(io.Discard)
+	logger.SetFormat(FormatJSON)
+	logger.SetCallerEnabled(true)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		logger.Info("request", Int("status", 200))
+	})
+	if allocs != 0 {
+		t.Errorf("caller capture allocated %.1f times per log", allocs)
+	}
+}
+
+func BenchmarkCaller(b *testing.B) {
+	logger := NewStructured()
+	logger.SetWriter(io.Discard)
+	logger.SetCallerEnabled(true)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("benchmark", Int("n", i))
+	}
+}
@@ -0,0 +1,37 @@
+package zlog
+
+import (
+	"time"
+	_ "unsafe" // for go:linkname
+)
+
+// Clock supplies the wall-clock time stamped on records.
+// A nil Clock means the system clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to the Clock interface
+type ClockFunc func() time.Time
+
+// Now returns f()
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// Runtime functions
+//
+//go:linkname timeNow time.now
+//go:noescape
+func timeNow() (sec int64, nsec int32, mono int64)
+
+// clockNow returns the current time of c in Unix nanoseconds
+//
+//go:inline
+func clockNow(c Clock) int64 {
+	if c == nil {
+		sec, nsec, _ := timeNow()
+		return sec*1e9 + int64(nsec)
+	}
+	return c.Now().UnixNano()
+}
@@ -0,0 +1,114 @@
+package zlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSystemClockTimestamp(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+
+	before := time.Now()
+	logger.Info("now")
+	after := time.Now()
+
+	var rec Record
+	if _, err := DecodeRecord(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Unix(0, rec.Time)
+	if ts.Before(before.Truncate(time.Microsecond)) || ts.After(after.Add(time.Millisecond)) {
+		t.Errorf("timestamp %v not between %v and %v", ts, before, after)
+	}
+	if rec.Flags&FlagMonotonic != 0 || rec.Monotonic != 0 {
+		t.Error("monotonic reading recorded without being enabled")
+	}
+}
+
+func TestFixedClock(t *testing.T) {
+	fixed := time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+	clock := ClockFunc(func() time.Time { return fixed })
+
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewLogfmtWriter(&out))
+	logger.SetClock(clock)
+
+	logger.Info("first", Int("n", 1))
+	logger.Info("second", Int("n", 2))
+
+	stamp := "time=" + fixed.Local().Format(time.RFC3339) + " "
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines", len(lines))
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, stamp) {
+			t.Errorf("line %q does not start with %q", line, stamp)
+		}
+	}
+}
+
+func TestClockAllLoggers(t *testing.T) {
+	fixed := time.Unix(1700000000, 123)
+	clock := ClockFunc(func() time.Time { return fixed })
+
+	var buf bytes.Buffer
+	basic := New()
+	basic.SetWriter(&buf)
+	basic.SetClock(clock)
+	basic.Info("basic")
+
+	ultimate := NewUltimateLogger()
+	ultimate.SetWriter(&buf)
+	ultimate.SetClock(clock)
+	ultimate.Info("ultimate")
+
+	b := buf.Bytes()
+	var rec Record
+	for len(b) > 0 {
+		n, err := DecodeRecord(b, &rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Time != fixed.UnixNano() {
+			t.Errorf("%s: time = %d, want %d", rec.Message, rec.Time, fixed.UnixNano())
+		}
+		b = b[n:]
+	}
+}
+
+func TestMonotonicAttribute(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+	logger.SetMonotonicEnabled(true)
+
+	logger.Info("one", String("k", "v"))
+	logger.InfoKV("two", "k", "v")
+
+	b := buf.Bytes()
+	var rec Record
+	var last int64
+	for len(b) > 0 {
+		n, err := DecodeRecord(b, &rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Flags&FlagMonotonic == 0 || rec.Monotonic == 0 {
+			t.Fatalf("%s: missing monotonic reading", rec.Message)
+		}
+		if rec.Monotonic < last {
+			t.Errorf("monotonic reading went backwards")
+		}
+		if rec.NumFields != 1 {
+			t.Errorf("%s: fields = %d, want 1", rec.Message, rec.NumFields)
+		}
+		last = rec.Monotonic
+		b = b[n:]
+	}
+}
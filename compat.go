@@ -1,8 +1,11 @@
 package zlog
 
 import (
+	"encoding"
+	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 )
 
 // Small buffer pool for integer conversions (removed - not needed with current optimization)
@@ -53,160 +56,157 @@ func (l *StructuredLogger) FatalKV(msg string, keysAndValues ...any) {
 	os.Exit(1)
 }
 
-// logKV logs with key-value pairs using simple formatting
+// logKV logs a mix of Fields and key-value pairs. The pairs become fields,
+// on the stack unless there are many, and are written like any structured
+// record.
 //
 //go:noinline
 func (l *StructuredLogger) logKV(level Level, msg string, keysAndValues ...any) {
-	// Estimate size
-	estimatedSize := 256 + len(msg)
-	// Get buffer from pool
-	bufPtr := getStructuredBuffer(estimatedSize)
-	buf := *bufPtr
-
-	// Ensure capacity
-	if cap(buf) < estimatedSize {
-		buf = make([]byte, estimatedSize, estimatedSize)
+	attrs := l.attrs(level)
+	ts := clockNow(l.clock)
+	// Each argument makes at most one field
+	if len(keysAndValues) > stackFieldCount {
+		p := getFields(len(keysAndValues))
+		l.writeFields(level, ts, msg, appendKVFields(*p, keysAndValues), &attrs)
+		putFields(p)
 	} else {
-		buf = buf[:estimatedSize]
+		var stackFields [stackFieldCount]Field
+		l.writeFields(level, ts, msg, appendKVFields(stackFields[:0], keysAndValues), &attrs)
 	}
-	pos := 0
-
-	// Binary header
-	pos += writeBinaryHeader(buf, level, l.sequence.Add(1))
-
-	// Message
-	msgLen := len(msg)
-	if msgLen > 255 {
-		msgLen = 255
-	}
-	buf[pos] = byte(msgLen)
-	pos++
-	copy(buf[pos:], msg[:msgLen])
-	pos += msgLen
-
-	// Convert KV pairs to fields
-	fieldCount := len(keysAndValues) / 2
-	if fieldCount > 255 {
-		fieldCount = 255
-	}
-	buf[pos] = byte(fieldCount)
-	pos++
-
-	// Encode each KV pair as a string field
-	for i := 0; i < len(keysAndValues)-1 && i/2 < fieldCount; i += 2 {
-		if pos >= len(buf)-64 {
-			break
-		}
+	attrs.release()
+}
 
-		// Convert key to string efficiently
-		key := toString(keysAndValues[i])
-
-		// Create appropriate field based on value type
-		var field Field
-		value := keysAndValues[i+1]
-
-		// Handle nil specially
-		if value == nil {
-			field = String(key, "<nil>")
-		} else {
-			switch v := value.(type) {
-			case string:
-				field = String(key, v)
-			case int:
-				field = Int(key, v)
-			case int64:
-				field = Int64(key, v)
-			case int32:
-				field = Int(key, int(v))
-			case int16:
-				field = Int(key, int(v))
-			case int8:
-				field = Int(key, int(v))
-			case uint:
-				field = Uint(key, v)
-			case uint64:
-				field = Uint64(key, v)
-			case uint32:
-				field = Uint(key, uint(v))
-			case uint16:
-				field = Uint(key, uint(v))
-			case uint8:
-				field = Uint(key, uint(v))
-			case float64:
-				field = Float64(key, v)
-			case float32:
-				field = Float32(key, v)
-			case bool:
-				field = Bool(key, v)
-			case []byte:
-				field = Bytes(key, v)
-			case error:
-				field = String(key, v.Error())
-			case fmt.Stringer:
-				field = String(key, v.String())
-			default:
-				// Only use fmt.Sprint for unknown types
-				field = String(key, fmt.Sprint(v))
+// badKey is the key of a value that was not preceded by a string key
+const badKey = "!BADKEY"
+
+// appendKVFields appends the fields for a mix of Fields and key-value
+// pairs. A Field is used as is. A key that is not a string, or a final
+// string without a value, becomes a !BADKEY field holding it.
+func appendKVFields(fields []Field, keysAndValues []any) []Field {
+	for i := 0; i < len(keysAndValues); i++ {
+		switch key := keysAndValues[i].(type) {
+		case Field:
+			fields = append(fields, key)
+		case string:
+			if i+1 == len(keysAndValues) {
+				fields = append(fields, String(badKey, key))
+				break
 			}
+			i++
+			fields = append(fields, kvField(key, keysAndValues[i]))
+		default:
+			fields = append(fields, kvField(badKey, key))
 		}
-		n := encodeField(buf[pos:], &field)
-		if n == 0 {
-			break // No more space
-		}
-		pos += n
 	}
+	return fields
+}
 
-	// Write
-	w := l.getWriter()
-	w.Write(buf[:pos])
+// kvField creates the field for a key-value pair based on the value type.
+// Types without a case of their own are handled by reflectField.
+func kvField(key string, value any) Field {
+	// Handle nil specially
+	if value == nil {
+		return String(key, "<nil>")
+	}
 
-	// Return buffer to pool
-	*bufPtr = buf
-	putStructuredBuffer(bufPtr)
+	switch v := value.(type) {
+	case Field:
+		v.Key = key
+		return v
+	case string:
+		return String(key, v)
+	case int:
+		return Int(key, v)
+	case int64:
+		return Int64(key, v)
+	case int32:
+		return Int(key, int(v))
+	case int16:
+		return Int(key, int(v))
+	case int8:
+		return Int(key, int(v))
+	case uint:
+		return Uint(key, v)
+	case uint64:
+		return Uint64(key, v)
+	case uint32:
+		return Uint(key, uint(v))
+	case uint16:
+		return Uint(key, uint(v))
+	case uint8:
+		return Uint(key, uint(v))
+	case uintptr:
+		return Uint64(key, uint64(v))
+	case float64:
+		return Float64(key, v)
+	case float32:
+		return Float32(key, v)
+	case bool:
+		return Bool(key, v)
+	case []byte:
+		return Bytes(key, v)
+	case error:
+		return errField(key, v)
+	case time.Time:
+		return Time(key, v)
+	case time.Duration:
+		return Duration(key, v)
+	}
+
+	// The methods of a nil pointer may panic; fmt logs it as <nil> too
+	if isNilPointer(value) {
+		return String(key, "<nil>")
+	}
+	switch v := value.(type) {
+	case ObjectMarshaler:
+		return Object(key, v)
+	case ArrayMarshaler:
+		return Array(key, v)
+	case json.Number:
+		return jsonNumberField(key, v)
+	case json.Marshaler:
+		return jsonField(key, v)
+	case encoding.TextMarshaler:
+		return textField(key, v)
+	case fmt.Stringer:
+		return String(key, v.String())
+	default:
+		return reflectField(key, value)
+	}
 }
 
 // Global compatibility functions that accept any type
 
 // DebugKV logs debug with key-value pairs
 func DebugKV(msg string, keysAndValues ...any) {
-	Default().DebugKV(msg, keysAndValues...)
+	if l := Default(); l.shouldLog(LevelDebug) {
+		l.logKV(LevelDebug, msg, keysAndValues...)
+	}
 }
 
 // InfoKV logs info with key-value pairs
 func InfoKV(msg string, keysAndValues ...any) {
-	Default().InfoKV(msg, keysAndValues...)
+	if l := Default(); l.shouldLog(LevelInfo) {
+		l.logKV(LevelInfo, msg, keysAndValues...)
+	}
 }
 
 // WarnKV logs warning with key-value pairs
 func WarnKV(msg string, keysAndValues ...any) {
-	Default().WarnKV(msg, keysAndValues...)
+	if l := Default(); l.shouldLog(LevelWarn) {
+		l.logKV(LevelWarn, msg, keysAndValues...)
+	}
 }
 
 // ErrorKV logs error with key-value pairs
 func ErrorKV(msg string, keysAndValues ...any) {
-	Default().ErrorKV(msg, keysAndValues...)
+	if l := Default(); l.shouldLog(LevelError) {
+		l.logKV(LevelError, msg, keysAndValues...)
+	}
 }
 
 // FatalKV logs fatal with key-value pairs and exits
 func FatalKV(msg string, keysAndValues ...any) {
-	Default().FatalKV(msg, keysAndValues...)
-}
-
-// Helper to create field from any type (for convenience)
-func Any(key string, value any) Field {
-	// Use string representation for simplicity
-	return String(key, fmt.Sprint(value))
-}
-
-// toString converts common types to string without allocation
-func toString(v any) string {
-	switch s := v.(type) {
-	case string:
-		return s
-	case []byte:
-		return string(s)
-	default:
-		// Only allocate for non-string types
-		return fmt.Sprint(v)
-	}
+	Default().logKV(LevelFatal, msg, keysAndValues...)
+	os.Exit(1)
 }
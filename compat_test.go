@@ -2,8 +2,12 @@ package zlog
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCompatibility(t *testing.T) {
@@ -84,6 +88,149 @@ func TestGlobalCompatibilityMigration(t *testing.T) {
 	// If we got here without panic, the API is compatible
 }
 
+type testStringer struct{ name string }
+
+func (s testStringer) String() string { return s.name }
+
+// kvTypes returns key-value pairs covering the types logged without
+// allocation. The values are variables so the caller has to box them.
+func kvTypes() []any {
+	var (
+		n   = 123456
+		u   = uint64(1 << 40)
+		f   = 2.5
+		s   = "hello world"
+		ts  = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		d   = 1500 * time.Millisecond
+		err = fmt.Errorf("read: %w", io.ErrUnexpectedEOF)
+	)
+	return []any{
+		"int", n, "int8", int8(-8), "int16", int16(-1600), "int32", int32(n), "int64", int64(n),
+		"uint", uint(n), "uint8", uint8(8), "uint16", uint16(1600), "uint32", uint32(n), "uint64", u, "uintptr", uintptr(n),
+		"float32", float32(f), "float64", f, "bool", true, "string", s,
+		"time", ts, "duration", d, "error", err, "stringer", testStringer{"svc"}, "field", Int("ignored", n),
+	}
+}
+
+func TestKVTypes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&buf))
+	logger.InfoKV("types", kvTypes()...)
+
+	out := buf.String()
+	for _, s := range []string{
+		`"int":123456,"int8":-8,"int16":-1600,"int32":123456,"int64":123456`,
+		`"uint":123456,"uint8":8,"uint16":1600,"uint32":123456,"uint64":1099511627776,"uintptr":123456`,
+		`"float32":2.5,"float64":2.5,"bool":true,"string":"hello world"`,
+		`"time":"2024-03-01T12:00:00Z","duration":"1.5s"`,
+		`"error":{"message":"read: unexpected EOF","type":"*fmt.wrapError","chain":["unexpected EOF"]}`,
+		`"stringer":"svc","field":123456`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output missing %s: %s", s, out)
+		}
+	}
+}
+
+func TestKVZeroAlloc(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful under the race detector")
+	}
+	// Boxing a constant or a pointer does not allocate, while boxing other
+	// variables does at the call site, see BenchmarkKVTypes. The variables
+	// are boxed up front so only the KV path itself is measured.
+	args := kvTypes()
+	err := errors.New("timeout")
+
+	for _, format := range []LogFormat{FormatBinary, FormatJSON, FormatText} {
+		logger := NewStructured()
+		logger.SetWriter(io.Discard)
+		logger.SetFormat(format)
+		prev := Default()
+		SetDefault(logger)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			Info("request", args...)
+			logger.InfoKV("request", "n", 123456, "s", "hello world", "took", time.Second, "error", err)
+		})
+		SetDefault(prev)
+		if allocs != 0 {
+			t.Errorf("format %d: %.1f allocs per log", format, allocs)
+		}
+	}
+}
+
+func TestKVNilPointer(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&buf))
+	logger.InfoKV("m", "svc", (*testNilStringer)(nil), "err", (*testNilError)(nil))
+
+	if !strings.HasSuffix(buf.String(), `"svc":"<nil>","err":{"message":"<nil>"}}`+"\n") {
+		t.Errorf("unexpected output %s", buf.String())
+	}
+}
+
+func TestKVErrorMatchesNamedErr(t *testing.T) {
+	err := fmt.Errorf("query: %w", &codedError{code: 7, op: "select"})
+	var kv, named bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&kv)
+	logger.InfoKV("failed", "error", err)
+	logger.SetWriter(&named)
+	logger.Info("failed", Err(err))
+
+	var a, b Record
+	if _, e := DecodeRecord(kv.Bytes(), &a); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := DecodeRecord(named.Bytes(), &b); e != nil {
+		t.Fatal(e)
+	}
+	if !bytes.Equal(a.fields, b.fields) {
+		t.Errorf("KV error encoded as %x, Err as %x", a.fields, b.fields)
+	}
+}
+
+func TestKVMixedFields(t *testing.T) {
+	tests := []struct {
+		name string
+		args []any
+		want string
+	}{
+		{"FieldsOnly", []any{String("host", "db"), Int("port", 5432)}, `"host":"db","port":5432`},
+		{"Interleaved", []any{Int("id", 7), "table", "users", Bool("ok", true), "n", 2}, `"id":7,"table":"users","ok":true,"n":2`},
+		{"OddCount", []any{"a", 1, "b"}, `"a":1,"!BADKEY":"b"`},
+		{"NonStringKey", []any{42, "x", "a"}, `"!BADKEY":42,"x":"a"`},
+		{"NonStringKeyLast", []any{"a", 1, 3.5}, `"a":1,"!BADKEY":3.5`},
+		{"FieldAfterBadKey", []any{true, String("k", "v")}, `"!BADKEY":true,"k":"v"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := NewStructured()
+			logger.SetWriter(NewJSONWriter(&buf))
+			prev := Default()
+			SetDefault(logger)
+			defer SetDefault(prev)
+
+			Info("m", tt.args...)
+			logger.WarnKV("m", tt.args...)
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("got %d lines", len(lines))
+			}
+			for _, line := range lines {
+				if !strings.HasSuffix(line, `"msg":"m",`+tt.want+`}`) {
+					t.Errorf("got %s, want fields %s", line, tt.want)
+				}
+			}
+		})
+	}
+}
+
 // Benchmark compatibility layer
 func BenchmarkCompatibilityKV(b *testing.B) {
 	logger := NewStructured()
@@ -104,3 +251,39 @@ func BenchmarkCompatibilityCommonTypes(b *testing.B) {
 		logger.InfoKV("test", "str", "value", "int", 42, "bool", true, "float", 3.14)
 	}
 }
+
+// BenchmarkKVTypes reports the cost of the KV path for variables of
+// common types. Variables boxes them at each call, which allocates for
+// values that are neither constants nor pointers; Preboxed leaves only
+// the KV path, which does not allocate.
+func BenchmarkKVTypes(b *testing.B) {
+	logger := NewStructured()
+	logger.SetWriter(io.Discard)
+	prev := Default()
+	SetDefault(logger)
+	defer SetDefault(prev)
+
+	b.Run("Variables", func(b *testing.B) {
+		var (
+			n   = 123456
+			f   = 2.5
+			s   = "hello world"
+			ts  = time.Now()
+			d   = 1500 * time.Millisecond
+			err = errors.New("timeout")
+		)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			n++
+			Info("request", "n", n, "f", f, "s", s, "time", ts, "took", d, "error", err, "field", Int("", n))
+		}
+	})
+
+	b.Run("Preboxed", func(b *testing.B) {
+		args := kvTypes()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			Info("request", args...)
+		}
+	})
+}
@@ -320,7 +320,7 @@ func TestRingBuffer(t *testing.T) {
 	}
 
 	// Test buffer full
-	for i := 0; i < 15; i++ { // Fill buffer (size-1)
+	for i := 0; i < 16; i++ { // Fill buffer (size)
 		if !rb.Put([]byte("x")) {
 			t.Errorf("Failed to put at %d", i)
 		}
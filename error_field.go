@@ -0,0 +1,381 @@
+package zlog
+
+import (
+	"reflect"
+	"slices"
+)
+
+// Bounds on what an error field records
+const (
+	maxErrorChain   = 16   // Layers recorded across the Unwrap tree
+	maxErrorDepth   = 8    // Nesting depth followed through Unwrap
+	maxErrorMessage = 1024 // Bytes kept per layer message
+	maxErrorFields  = 32   // Fields collected from LogFielder layers
+)
+
+// LogFielder is implemented by errors that carry structured details.
+// Err records the fields of every layer in the chain that implements it.
+type LogFielder interface {
+	LogFields() []Field
+}
+
+// Err creates an error field with the key "error"
+func Err(err error) Field {
+	return NamedErr("error", err)
+}
+
+// NamedErr creates an error field. It records the message of each layer
+// reachable through errors.Unwrap and errors.Join, the concrete type name,
+// and the fields of layers implementing LogFielder. The error is encoded
+// when the field is created.
+func NamedErr(key string, err error) Field {
+	return Field{Key: key, Type: FieldTypeError, str: BytesToString(appendError(nil, err))}
+}
+
+// errField creates an error field that encodes err once the record is
+// written, see resolveFields, for fields that do not outlive the logging
+// call
+//
+//go:inline
+func errField(key string, err error) Field {
+	return Field{Key: key, Type: FieldTypeError, obj: err}
+}
+
+// errorPayloadSize returns the encoded size of an error field's payload
+//
+//go:inline
+func (f *Field) errorPayloadSize() int {
+	if err, ok := f.obj.(error); ok {
+		return encodeError(nil, err)
+	}
+	return len(f.str)
+}
+
+// nilErrorPayload is the payload of a nil error
+var nilErrorPayload = []byte{0, 1, 0, 5, '<', 'n', 'i', 'l', '>', 0}
+
+// encodeError encodes an error field payload into buf and returns its
+// size. With a nil buf it only returns the size. buf must have room for
+// that size; 0 is returned if the payload does not fit.
+//
+//	type name length (1) | type name
+//	layer count (1)      | per layer: length (uint16 BE) | message
+//	field count (1)      | encoded fields
+//
+// The first layer is err itself. A nil pointer is encoded as a nil error.
+func encodeError(buf []byte, err error) int {
+	if err == nil || isNilPointer(err) {
+		if buf == nil {
+			return len(nilErrorPayload)
+		}
+		return copy(buf, nilErrorPayload)
+	}
+	w := errorWriter{buf: buf}
+	countPos, count := w.error(err)
+	if w.buf == nil {
+		return w.pos
+	}
+	if w.pos > len(w.buf) {
+		// The error changed since it was measured
+		return 0
+	}
+	w.buf[countPos] = byte(count)
+	return w.pos
+}
+
+// appendError appends an error field payload, as encodeError writes it, to
+// dst. Unlike measuring and then encoding, it calls the methods of each
+// layer once.
+func appendError(dst []byte, err error) []byte {
+	if err == nil || isNilPointer(err) {
+		return append(dst, nilErrorPayload...)
+	}
+	w := errorWriter{buf: dst, grow: true}
+	countPos, count := w.error(err)
+	w.buf[len(dst)+countPos] = byte(count)
+	return w.buf
+}
+
+// errorWriter writes an error payload, or only measures it when buf is
+// nil. With grow, it appends to buf instead. pos is the payload size so
+// far.
+type errorWriter struct {
+	buf  []byte
+	pos  int
+	grow bool
+}
+
+// error writes the payload of err and returns the position and value of
+// its field count
+func (w *errorWriter) error(err error) (countPos, count int) {
+	typ := reflect.TypeOf(err).String()
+	if len(typ) > 255 {
+		typ = typ[:255]
+	}
+	w.byte(byte(len(typ)))
+	w.string(typ)
+
+	// Layer messages, depth first
+	var stack [maxErrorChain]error
+	layers := collectErrorLayers(stack[:0], err, 0)
+	w.byte(byte(len(layers)))
+	for _, e := range layers {
+		msg := e.Error()
+		if len(msg) > maxErrorMessage {
+			msg = msg[:maxErrorMessage]
+		}
+		w.byte(byte(len(msg) >> 8))
+		w.byte(byte(len(msg)))
+		w.string(msg)
+	}
+
+	// Details from LogFielder layers
+	countPos = w.pos
+	w.byte(0)
+	for _, e := range layers {
+		lf, ok := e.(LogFielder)
+		if !ok {
+			continue
+		}
+		for _, f := range lf.LogFields() {
+			if count == maxErrorFields || !w.field(&f) {
+				break
+			}
+			count++
+		}
+	}
+	return countPos, count
+}
+
+//go:inline
+func (w *errorWriter) byte(c byte) {
+	if w.grow {
+		w.buf = append(w.buf, c)
+	} else if w.buf != nil && w.pos < len(w.buf) {
+		w.buf[w.pos] = c
+	}
+	w.pos++
+}
+
+//go:inline
+func (w *errorWriter) string(s string) {
+	if w.grow {
+		w.buf = append(w.buf, s...)
+	} else if w.buf != nil && w.pos < len(w.buf) {
+		copy(w.buf[w.pos:], s)
+	}
+	w.pos += len(s)
+}
+
+// field writes a detail field and reports whether it fit within the
+// payload limit
+func (w *errorWriter) field(f *Field) bool {
+	size := fieldSize(f)
+	if w.pos+size > maxMessageLen-2 {
+		return false
+	}
+	if w.grow {
+		end := len(w.buf)
+		w.buf = slices.Grow(w.buf, size)
+		n := encodeField(w.buf[end:end+size], f)
+		w.buf = w.buf[:end+n]
+		w.pos += n
+		return n > 0
+	}
+	if w.buf == nil {
+		w.pos += size
+		return true
+	}
+	if w.pos >= len(w.buf) {
+		return false
+	}
+	n := encodeField(w.buf[w.pos:], f)
+	w.pos += n
+	return n > 0
+}
+
+// collectErrorLayers appends err and the errors it wraps, depth first,
+// leaving out nil pointers
+func collectErrorLayers(layers []error, err error, depth int) []error {
+	if err == nil || isNilPointer(err) || len(layers) == maxErrorChain {
+		return layers
+	}
+	layers = append(layers, err)
+	if depth+1 == maxErrorDepth {
+		return layers
+	}
+
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		layers = collectErrorLayers(layers, e.Unwrap(), depth+1)
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			layers = collectErrorLayers(layers, inner, depth+1)
+		}
+	}
+	return layers
+}
+
+// errorPayload is a decoded error field value. Its slices point into the
+// encoded record.
+type errorPayload struct {
+	typ     []byte
+	layers  []byte // Length-prefixed messages
+	nLayers int
+	fields  []byte
+	nFields int
+}
+
+// decodeErrorPayload splits an error field payload into its sections
+func decodeErrorPayload(b []byte) (errorPayload, bool) {
+	var p errorPayload
+	if len(b) < 1 || len(b) < 1+int(b[0])+1 {
+		return p, false
+	}
+	pos := 1 + int(b[0])
+	p.typ = b[1:pos]
+
+	p.nLayers = int(b[pos])
+	pos++
+	start := pos
+	for i := 0; i < p.nLayers; i++ {
+		if len(b)-pos < 2 {
+			return p, false
+		}
+		pos += 2 + int(uint16(b[pos])<<8|uint16(b[pos+1]))
+	}
+	if pos >= len(b) {
+		return p, false
+	}
+	p.layers = b[start:pos]
+
+	p.nFields = int(b[pos])
+	p.fields = b[pos+1:]
+	return p, true
+}
+
+// nextErrorLayer returns the message of the layer at the start of b and
+// the rest
+//
+//go:inline
+func nextErrorLayer(b []byte) (msg, rest []byte) {
+	n := 2 + int(uint16(b[0])<<8|uint16(b[1]))
+	return b[2:n], b[n:]
+}
+
+// message returns the message of the outermost layer
+func (p *errorPayload) message() []byte {
+	if p.nLayers == 0 {
+		return nil
+	}
+	msg, _ := nextErrorLayer(p.layers)
+	return msg
+}
+
+// fieldReader returns a reader over the detail fields
+func (p *errorPayload) fieldReader() fieldReader {
+	return fieldReader{b: p.fields, n: p.nFields}
+}
+
+// appendJSONError renders an error payload as an object:
+// {"message":...,"type":...,"chain":[...],"fields":{...}}. The chain lists
+// the wrapped layers and is omitted when there are none.
+func appendJSONError(buf []byte, data []byte, enc *valueEncoding) []byte {
+	p, ok := decodeErrorPayload(data)
+	if !ok {
+		return append(buf, "null"...)
+	}
+
+	buf = append(buf, `{"message":`...)
+	buf = appendJSONString(buf, p.message())
+	if len(p.typ) > 0 {
+		buf = append(buf, `,"type":`...)
+		buf = appendJSONString(buf, p.typ)
+	}
+
+	if p.nLayers > 1 {
+		buf = append(buf, `,"chain":[`...)
+		_, rest := nextErrorLayer(p.layers)
+		for i := 1; i < p.nLayers; i++ {
+			var msg []byte
+			msg, rest = nextErrorLayer(rest)
+			if i > 1 {
+				buf = append(buf, ',')
+			}
+			buf = appendJSONString(buf, msg)
+		}
+		buf = append(buf, ']')
+	}
+
+	if p.nFields > 0 {
+		buf = append(buf, `,"fields":{`...)
+		fr := p.fieldReader()
+		for {
+			f, ok := fr.next()
+			if !ok {
+				break
+			}
+			num, data := decodeValue(f.typ, f.val)
+			buf = appendJSONField(buf, f.key, f.typ, num, data, enc)
+		}
+		buf = append(buf, '}')
+	}
+	return append(buf, '}')
+}
+
+// appendLogfmtError renders an error payload as key="message" followed by
+// key.type, key.chain (wrapped layers joined with " | ") and key.<field>
+// pairs
+func appendLogfmtError(buf []byte, key []byte, data []byte, enc *valueEncoding) []byte {
+	p, ok := decodeErrorPayload(data)
+	if !ok {
+		return append(buf, '?')
+	}
+	buf = appendQuoted(buf, BytesToString(p.message()))
+
+	if len(p.typ) > 0 {
+		buf = appendErrorSubkey(buf, key, "type")
+		buf = appendQuoted(buf, BytesToString(p.typ))
+	}
+
+	if p.nLayers > 1 {
+		// Join into a scratch buffer so the whole chain is quoted once
+		bufPtr := GetBuffer(len(p.layers) + 3*p.nLayers)
+		chain := (*bufPtr)[:0]
+		_, rest := nextErrorLayer(p.layers)
+		for i := 1; i < p.nLayers; i++ {
+			var msg []byte
+			msg, rest = nextErrorLayer(rest)
+			if i > 1 {
+				chain = append(chain, " | "...)
+			}
+			chain = append(chain, msg...)
+		}
+		buf = appendErrorSubkey(buf, key, "chain")
+		buf = appendQuoted(buf, BytesToString(chain))
+		*bufPtr = chain
+		PutBuffer(bufPtr)
+	}
+
+	var keyBuf [128]byte
+	fr := p.fieldReader()
+	for {
+		f, ok := fr.next()
+		if !ok {
+			break
+		}
+		sub := appendNestedKey(keyBuf[:0], key, FieldTypeObject, f.key, 0)
+		num, data := decodeValue(f.typ, f.val)
+		buf = appendLogfmtField(buf, sub, f.typ, num, data, enc)
+	}
+	return buf
+}
+
+// appendErrorSubkey appends " key.sub="
+func appendErrorSubkey(buf []byte, key []byte, sub string) []byte {
+	buf = append(buf, ' ')
+	buf = append(buf, key...)
+	buf = append(buf, '.')
+	buf = append(buf, sub...)
+	return append(buf, '=')
+}
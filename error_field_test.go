@@ -0,0 +1,212 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// codedError carries structured details
+type codedError struct {
+	code int
+	op   string
+}
+
+func (e *codedError) Error() string { return fmt.Sprintf("%s failed with %d", e.op, e.code) }
+
+func (e *codedError) LogFields() []Field {
+	return []Field{Int("code", e.code), String("op", e.op)}
+}
+
+func TestErrFieldJSON(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&out))
+
+	base := &codedError{code: 42, op: "read"}
+	err := fmt.Errorf("load config: %w", base)
+	logger.Error("failed", Err(err))
+
+	var obj struct {
+		Error struct {
+			Message string         `json:"message"`
+			Type    string         `json:"type"`
+			Chain   []string       `json:"chain"`
+			Fields  map[string]any `json:"fields"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &obj); err != nil {
+		t.Fatalf("%v: %s", err, out.Bytes())
+	}
+	e := obj.Error
+	if e.Message != "load config: read failed with 42" || e.Type != "*fmt.wrapError" {
+		t.Errorf("message=%q type=%q", e.Message, e.Type)
+	}
+	if len(e.Chain) != 1 || e.Chain[0] != "read failed with 42" {
+		t.Errorf("chain = %q", e.Chain)
+	}
+	if e.Fields["code"] != 42.0 || e.Fields["op"] != "read" {
+		t.Errorf("fields = %v", e.Fields)
+	}
+}
+
+func TestErrFieldJoin(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewLogfmtWriter(&out))
+
+	err := errors.Join(errors.New("first"), fmt.Errorf("second: %w", io.EOF))
+	logger.Error("failed", NamedErr("cause", err))
+
+	line := out.String()
+	for _, want := range []string{
+		`cause="first\nsecond: EOF"`,
+		` cause.type=*errors.joinError`,
+		` cause.chain="first | second: EOF | EOF"`,
+	} {
+		if !strings.Contains(line, want) {
+			t.Errorf("%q lacks %q", line, want)
+		}
+	}
+}
+
+func TestErrFieldBounded(t *testing.T) {
+	err := errors.New(strings.Repeat("x", 2*maxErrorMessage))
+	for i := 0; i < 2*maxErrorChain; i++ {
+		err = fmt.Errorf("layer %d: %w", i, err)
+	}
+
+	var rec Record
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+	logger.Error("deep", Err(err))
+	if _, err := DecodeRecord(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+
+	fr := rec.fieldReader()
+	f, ok := fr.next()
+	if !ok || f.typ != FieldTypeError {
+		t.Fatal("missing error field")
+	}
+	_, data := decodeValue(f.typ, f.val)
+	p, ok := decodeErrorPayload(data)
+	if !ok {
+		t.Fatal("malformed payload")
+	}
+	if p.nLayers != maxErrorDepth {
+		t.Errorf("recorded %d layers, want %d", p.nLayers, maxErrorDepth)
+	}
+	if len(p.message()) != maxErrorMessage {
+		t.Errorf("message length %d, want %d", len(p.message()), maxErrorMessage)
+	}
+}
+
+func TestErrFieldNil(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&out))
+	logger.Error("nil", Err(nil))
+
+	if !strings.Contains(out.String(), `"error":{"message":"<nil>"}`) {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestErrFieldNilPointer(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&out))
+	var err *testNilError
+	logger.Error("nil", Err(err), NamedErr("wrapped", fmt.Errorf("query: %w", err)))
+
+	if !strings.Contains(out.String(), `"error":{"message":"<nil>"},"wrapped":{"message":"query: <nil>","type":"*fmt.wrapError"}`) {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+// countingError counts the calls of its methods
+type countingError struct {
+	errors, fields int
+}
+
+func (e *countingError) Error() string { e.errors++; return "counted" }
+
+func (e *countingError) LogFields() []Field { e.fields++; return []Field{Int("n", e.errors)} }
+
+func TestErrFieldEncodedOnce(t *testing.T) {
+	for _, format := range []LogFormat{FormatBinary, FormatJSON, FormatText} {
+		logger := NewStructured()
+		logger.SetWriter(io.Discard)
+		logger.SetFormat(format)
+
+		var kv, field countingError
+		logger.InfoKV("m", "err", &kv)
+		logger.Info("m", Any("err", &field))
+		logger.With(Any("err", &field)).Info("m")
+		if kv.errors != 1 || kv.fields != 1 {
+			t.Errorf("format %d: KV error: %d Error and %d LogFields calls, want 1", format, kv.errors, kv.fields)
+		}
+		if field.errors != 2 || field.fields != 2 {
+			t.Errorf("format %d: Any error: %d Error and %d LogFields calls, want 2 for two records", format, field.errors, field.fields)
+		}
+	}
+}
+
+func TestErrFieldKV(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&out))
+	logger.ErrorKV("kv", "err", fmt.Errorf("wrapped: %w", io.EOF))
+
+	if !strings.Contains(out.String(), `"err":{"message":"wrapped: EOF","type":"*fmt.wrapError","chain":["EOF"]}`) {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestErrFieldTerminal(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewTerminalWriter(&out))
+	logger.Error("failed", Err(&codedError{code: 7, op: "write"}))
+
+	if !strings.Contains(out.String(), `error="write failed with 7" {code=7 op=write}`) {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestErrFieldDirectFormats(t *testing.T) {
+	clock := ClockFunc(func() time.Time { return time.Unix(1700000000, 0) })
+	err := fmt.Errorf("outer: %w", &codedError{code: 1, op: "dial"})
+
+	for _, tt := range []struct {
+		format LogFormat
+		writer func(io.Writer) io.Writer
+	}{
+		{FormatJSON, func(w io.Writer) io.Writer { return NewJSONWriter(w) }},
+		{FormatText, func(w io.Writer) io.Writer { return NewLogfmtWriter(w) }},
+	} {
+		var decoded, direct bytes.Buffer
+
+		viaWriter := NewStructured()
+		viaWriter.SetClock(clock)
+		viaWriter.SetWriter(tt.writer(&decoded))
+		viaWriter.With(Err(io.EOF)).Error("e", Err(err))
+
+		viaFormat := NewStructured()
+		viaFormat.SetClock(clock)
+		viaFormat.SetFormat(tt.format)
+		viaFormat.SetWriter(&direct)
+		viaFormat.With(Err(io.EOF)).Error("e", Err(err))
+
+		if direct.String() != decoded.String() {
+			t.Errorf("format %d: direct %q, writer %q", tt.format, direct.String(), decoded.String())
+		}
+	}
+}
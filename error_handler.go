@@ -0,0 +1,115 @@
+package zlog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// errorReportInterval is the minimum time between two calls of an
+// ErrorHandler for the same logger
+const errorReportInterval = time.Second
+
+// ErrStderrFailover is reported, wrapping the last write error, when a
+// logger replaces its writer with stderr. See SetStderrFailover.
+var ErrStderrFailover = errors.New("zlog: failing over to stderr")
+
+// ErrorHandler receives the errors of a logger's writer. err is the latest
+// error and level the level of the record that failed. Calls are rate
+// limited to one per second; count is the number of failed writes since
+// the previous call, including this one.
+//
+// The handler runs on the goroutine that logged and must not log through
+// the same logger.
+type ErrorHandler func(err error, level Level, count uint64)
+
+var defaultErrorHandler atomic.Pointer[ErrorHandler]
+
+// SetDefaultErrorHandler sets the handler for loggers without their own,
+// see SetErrorHandler. nil, the default, discards write errors.
+func SetDefaultErrorHandler(h ErrorHandler) {
+	if h == nil {
+		defaultErrorHandler.Store(nil)
+		return
+	}
+	defaultErrorHandler.Store(&h)
+}
+
+// writeErrors tracks the failed writes of a logger
+type writeErrors struct {
+	handler  ErrorHandler // Nil for the default handler
+	failover int          // Consecutive failures before stderr; 0 never
+
+	consecutive atomic.Int64
+	pending     atomic.Uint64 // Failures not reported yet
+	lastReport  atomic.Int64  // nanotime of the last report
+}
+
+// writeRecord writes a record to the writer held by aw. text records are
+// already encoded as text; binary ones are decoded to logfmt if the logger
+// fails over to stderr.
+//
+//go:inline
+func writeRecord(aw *atomicWriter, errs *writeErrors, level Level, p []byte, text bool) {
+	b := aw.acquire()
+	if b == nil {
+		return
+	}
+	if _, err := b.w.Write(p); err != nil {
+		errs.failed(aw, b, level, p, text, err)
+	} else if errs.consecutive.Load() != 0 {
+		errs.consecutive.Store(0)
+	}
+	b.release()
+}
+
+// failed reports a failed write of p to the writer in b, and replaces the
+// writer with stderr once there were errs.failover failures in a row
+//
+//go:noinline
+func (errs *writeErrors) failed(aw *atomicWriter, b *writerBox, level Level, p []byte, text bool, err error) {
+	errs.pending.Add(1)
+
+	if n := errs.consecutive.Add(1); errs.failover > 0 && n >= int64(errs.failover) {
+		var stderr Writer = os.Stderr
+		if !text {
+			stderr = NewLogfmtWriter(os.Stderr)
+		}
+		if aw.p.CompareAndSwap(b, &writerBox{w: stderr}) {
+			errs.consecutive.Store(0)
+			stderr.Write(p)
+			errs.report(fmt.Errorf("%w after %d failed writes: %w", ErrStderrFailover, n, err), level, true)
+			return
+		}
+	}
+	errs.report(err, level, false)
+}
+
+// report passes err and the failures counted since the last report to the
+// handler, unless it was called less than errorReportInterval ago
+func (errs *writeErrors) report(err error, level Level, force bool) {
+	h := errs.handler
+	if h == nil {
+		p := defaultErrorHandler.Load()
+		if p == nil {
+			return
+		}
+		h = *p
+	}
+
+	now := nanotime()
+	if force {
+		errs.lastReport.Store(now)
+	} else {
+		last := errs.lastReport.Load()
+		if last != 0 && now-last < int64(errorReportInterval) {
+			return
+		}
+		if !errs.lastReport.CompareAndSwap(last, now) {
+			return
+		}
+	}
+	h(err, level, errs.pending.Swap(0))
+}
@@ -0,0 +1,141 @@
+package zlog
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+// failingWriter fails every write with err
+type failingWriter struct {
+	err    error
+	writes int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, w.err
+}
+
+type writeError struct {
+	err   error
+	level Level
+	count uint64
+}
+
+func TestErrorHandler(t *testing.T) {
+	diskFull := errors.New("no space left on device")
+	var reported []writeError
+	logger := NewStructured()
+	logger.SetWriter(&failingWriter{err: diskFull})
+	logger.SetErrorHandler(func(err error, level Level, count uint64) {
+		reported = append(reported, writeError{err, level, count})
+	})
+
+	logger.Warn("first")
+	logger.Info("second", Int("n", 2))
+	logger.Error("third")
+
+	// The first error is reported at once, the others wait for the next
+	// report a second later
+	if len(reported) != 1 || reported[0] != (writeError{diskFull, LevelWarn, 1}) {
+		t.Fatalf("reported %v", reported)
+	}
+
+	logger.errs.lastReport.Add(-int64(errorReportInterval))
+	logger.Info("fourth")
+	if len(reported) != 2 || reported[1] != (writeError{diskFull, LevelInfo, 3}) {
+		t.Errorf("reported %v", reported)
+	}
+}
+
+func TestDefaultErrorHandler(t *testing.T) {
+	var count uint64
+	SetDefaultErrorHandler(func(err error, level Level, n uint64) { count += n })
+	defer SetDefaultErrorHandler(nil)
+
+	for _, format := range []LogFormat{FormatBinary, FormatJSON} {
+		logger := NewStructured()
+		logger.SetFormat(format)
+		logger.SetWriter(&failingWriter{err: os.ErrClosed})
+		logger.Info("closed")
+	}
+	ultimate := NewUltimateLogger()
+	ultimate.SetWriter(&failingWriter{err: os.ErrClosed})
+	ultimate.Info("closed")
+
+	if count != 3 {
+		t.Errorf("default handler counted %d errors", count)
+	}
+}
+
+func TestErrorHandlerResetOnSuccess(t *testing.T) {
+	w := &failingWriter{err: os.ErrClosed}
+	logger := NewStructured()
+	logger.SetWriter(w)
+	logger.SetStderrFailover(2)
+
+	logger.Info("fails")
+	w.err = nil
+	logger.Info("succeeds")
+	w.err = os.ErrClosed
+	logger.Info("fails")
+
+	if logger.getWriter() != w {
+		t.Error("failed over after non-consecutive failures")
+	}
+}
+
+func TestStderrFailover(t *testing.T) {
+	r, stderr, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stderr
+	os.Stderr = stderr
+	defer func() { os.Stderr = orig }()
+
+	var reported []error
+	w := &failingWriter{err: os.ErrClosed}
+	logger := NewStructured()
+	logger.SetWriter(w)
+	logger.SetStderrFailover(3)
+	logger.SetErrorHandler(func(err error, level Level, count uint64) {
+		reported = append(reported, err)
+	})
+
+	for i := 0; i < 3; i++ {
+		logger.Info("lost", Int("i", i))
+	}
+	logger.Info("after")
+	stderr.Close()
+
+	var out bytes.Buffer
+	out.ReadFrom(r)
+	if w.writes != 3 {
+		t.Errorf("failing writer got %d writes", w.writes)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("msg=lost i=2")) || !bytes.Contains(out.Bytes(), []byte("msg=after")) {
+		t.Errorf("stderr got %q", out.Bytes())
+	}
+	if len(reported) != 2 || !errors.Is(reported[1], ErrStderrFailover) || !errors.Is(reported[1], os.ErrClosed) {
+		t.Errorf("reported %v", reported)
+	}
+}
+
+func TestErrorHandlerZeroAlloc(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful under the race detector")
+	}
+	logger := NewStructured()
+	logger.SetWriter(&failingWriter{err: os.ErrClosed})
+	logger.SetErrorHandler(func(err error, level Level, count uint64) {})
+
+	allocs := testing.AllocsPerRun(100, func() {
+		logger.Info("closed", Int("n", 1))
+	})
+	if allocs != 0 {
+		t.Errorf("%.1f allocs per failed write", allocs)
+	}
+}
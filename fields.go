@@ -1,8 +1,11 @@
 package zlog
 
 import (
+	"math"
 	"os"
+	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -17,6 +20,11 @@ const (
 	FieldTypeString
 	FieldTypeBool
 	FieldTypeBytes
+	FieldTypeError
+	FieldTypeTime
+	FieldTypeDuration
+	FieldTypeObject
+	FieldTypeArray
 )
 
 // Field represents a typed field without allocations
@@ -27,6 +35,7 @@ type Field struct {
 	num uint64         // For int/uint/bool
 	str string         // For string
 	ptr unsafe.Pointer // For bytes
+	obj any            // For object and array marshalers and unencoded errors
 }
 
 // Int creates an int field
@@ -93,7 +102,32 @@ func Bool(key string, val bool) Field {
 //
 //go:inline
 func Bytes(key string, val []byte) Field {
-	return Field{Key: key, Type: FieldTypeBytes, ptr: unsafe.Pointer(&val[0]), num: uint64(len(val))}
+	return Field{Key: key, Type: FieldTypeBytes, ptr: unsafe.Pointer(unsafe.SliceData(val)), num: uint64(len(val))}
+}
+
+// Time creates a time field, stored as Unix nanoseconds. Times outside the
+// years 1678 to 2262, such as the zero time, do not fit and are logged as
+// an RFC 3339 string in UTC instead.
+//
+//go:inline
+func Time(key string, val time.Time) Field {
+	if sec := val.Unix(); sec < minTimeSec || sec > maxTimeSec {
+		return String(key, val.UTC().Format(time.RFC3339Nano))
+	}
+	return Field{Key: key, Type: FieldTypeTime, num: uint64(val.UnixNano())}
+}
+
+// The range of seconds of times whose Unix nanoseconds fit an int64
+const (
+	minTimeSec = math.MinInt64 / int64(time.Second)
+	maxTimeSec = math.MaxInt64/int64(time.Second) - 1
+)
+
+// Duration creates a duration field
+//
+//go:inline
+func Duration(key string, val time.Duration) Field {
+	return Field{Key: key, Type: FieldTypeDuration, num: uint64(val)}
 }
 
 // getStructuredBuffer gets a buffer for structured logging
@@ -110,12 +144,13 @@ func putStructuredBuffer(buf *[]byte) {
 // StructuredLogger provides zero-allocation structured logging
 type StructuredLogger struct {
 	*Logger
-	sequence atomic.Uint64
+	sequence *atomic.Uint64 // Shared with child loggers
+	ctx      *contextFields // Fields added by With
 }
 
 // NewStructured creates a new structured logger
 func NewStructured() *StructuredLogger {
-	return &StructuredLogger{Logger: New()}
+	return &StructuredLogger{Logger: New(), sequence: new(atomic.Uint64)}
 }
 
 // shouldLog checks if the given level should be logged
@@ -132,29 +167,39 @@ func (l *StructuredLogger) getWriter() Writer {
 //
 //go:noinline
 func (l *StructuredLogger) logFields(level Level, msg string, fields []Field) {
-	// Estimate required size
-	msgLen := len(msg)
-	if msgLen > 255 {
-		msgLen = 255
-	}
+	attrs := l.attrs(level)
+	l.writeFields(level, clockNow(l.clock), msg, fields, &attrs)
+	attrs.release()
+}
 
-	// Calculate size: header(22) + msgLen(1) + msg + fieldCount(1) + fields
-	estimatedSize := 24 + msgLen
-	for _, f := range fields {
-		estimatedSize += 2 + len(f.Key) + 16 // Conservative estimate
+// writeFields encodes and writes a record with the given timestamp
+func (l *StructuredLogger) writeFields(level Level, ts int64, msg string, fields []Field, attrs *recordAttrs) {
+	for i := range fields {
+		if fields[i].unresolved() {
+			l.writeResolvedFields(level, ts, msg, fields, attrs)
+			return
+		}
 	}
 
-	// For small logs, use stack allocation
-	if estimatedSize <= 512 {
-		var stackBuf [512]byte
-		n := l.formatStructuredMessage(stackBuf[:], level, msg, fields)
-		if l.getWriter() != nil {
-			l.getWriter().Write(stackBuf[:n])
-		}
+	if l.format != FormatBinary {
+		l.logText(level, ts, l.sequence.Add(1), msg, l.ctx, fields, attrs)
 		return
 	}
 
-	// Get buffer from pool
+	// Estimate required size
+	msgLen := len(msg)
+	if msgLen > maxMessageLen {
+		msgLen = maxMessageLen
+	}
+
+	// Calculate size: header + msgLen(2) + msg + fieldCount(2) + fields
+	estimatedSize := recordHeaderSize + 4 + msgLen + l.attrSize(attrs) + l.contextSize()
+	for i := range fields {
+		estimatedSize += fieldSize(&fields[i])
+	}
+
+	// Get buffer from pool. A stack buffer would escape through the
+	// writer interface.
 	bufPtr := getStructuredBuffer(estimatedSize)
 	buf := *bufPtr
 
@@ -164,79 +209,147 @@ func (l *StructuredLogger) logFields(level Level, msg string, fields []Field) {
 	}
 
 	// Format message
-	n := l.formatStructuredMessage(buf[:cap(buf)], level, msg, fields)
+	n := l.formatStructuredMessage(buf[:cap(buf)], level, ts, msg, fields, attrs)
 
 	// Write
-	if l.getWriter() != nil {
-		l.getWriter().Write(buf[:n])
-	}
+	writeRecord(&l.writer, &l.errs, level, buf[:n], false)
 
 	// Return buffer to pool
 	*bufPtr = buf
 	putStructuredBuffer(bufPtr)
 }
 
+// writeResolvedFields computes the lazy values and encodes the errors of
+// fields once, on a copy, and writes the record
+func (l *StructuredLogger) writeResolvedFields(level Level, ts int64, msg string, fields []Field, attrs *recordAttrs) {
+	payloads := GetBuffer(0)
+	if len(fields) > stackFieldCount {
+		p := getFields(len(fields))
+		l.writeFields(level, ts, msg, resolveFields(*p, payloads, fields), attrs)
+		putFields(p)
+	} else {
+		var stackFields [stackFieldCount]Field
+		l.writeFields(level, ts, msg, resolveFields(stackFields[:0], payloads, fields), attrs)
+	}
+	PutBuffer(payloads)
+}
+
+// stackFieldCount is the number of fields a record builds on the stack;
+// larger records use slices from fieldsPool
+const stackFieldCount = 16
+
+var fieldsPool = sync.Pool{
+	New: func() any { return new([]Field) },
+}
+
+// getFields returns an empty field slice with room for n fields, to append
+// to without storing the result
+func getFields(n int) *[]Field {
+	p := fieldsPool.Get().(*[]Field)
+	if cap(*p) < n {
+		*p = make([]Field, 0, n)
+	}
+	return p
+}
+
+// putFields clears a field slice, so it keeps no values alive, and
+// recycles it
+func putFields(p *[]Field) {
+	clear((*p)[:cap(*p)])
+	fieldsPool.Put(p)
+}
+
 // formatStructuredMessage formats the message and returns bytes written
-func (l *StructuredLogger) formatStructuredMessage(buf []byte, level Level, msg string, fields []Field) int {
-	pos := 0
+func (l *StructuredLogger) formatStructuredMessage(buf []byte, level Level, ts int64, msg string, fields []Field, attrs *recordAttrs) int {
+	var flags RecordFlags
+
+	// Keep room for attribute sections after the fields
+	end := len(buf) - l.attrSize(attrs)
 
 	// Binary header
-	pos += writeBinaryHeader(buf[:], level, l.sequence.Add(1))
+	pos := writeBinaryHeader(buf, level, l.sequence.Add(1), ts)
 
 	// Message
-	msgLen := len(msg)
-	if msgLen > 255 {
-		msgLen = 255
+	pos, truncated := writeMessage(buf[:end], pos, msg)
+	if truncated {
+		flags |= FlagTruncated
 	}
-	buf[pos] = byte(msgLen)
-	pos++
-	copy(buf[pos:], msg[:msgLen])
-	pos += msgLen
 
-	// Field count
-	fieldCount := len(fields)
-	if fieldCount > 255 {
-		fieldCount = 255
+	// Field count, patched once we know how many fields fit
+	countPos := pos
+	pos += 2
+
+	// Context fields first, then the call's own fields
+	pos, count := l.writeContext(buf[:end], pos)
+	total := len(fields)
+	if l.ctx != nil {
+		total += l.ctx.count
 	}
-	buf[pos] = byte(fieldCount)
-	pos++
 
 	// Encode fields
-	for i := 0; i < fieldCount && pos < len(buf)-64; i++ {
-		pos += encodeField(buf[pos:], &fields[i])
+	for i := 0; i < len(fields) && count < maxFieldCount; i++ {
+		n := encodeField(buf[pos:end], &fields[i])
+		if n == 0 {
+			break // No more space
+		}
+		pos += n
+		count++
+	}
+	if count < total {
+		flags |= FlagTruncated
 	}
+	setFieldCount(buf, countPos, count)
 
+	pos, flags = l.writeAttrs(buf, pos, flags, attrs)
+	finishRecord(buf, pos, flags)
 	return pos
 }
 
-// writeBinaryHeader writes the standard header
+// fieldSize returns the encoded size of a field. Objects and arrays are
+// marshaled to measure them.
 //
 //go:inline
-func writeBinaryHeader(buf []byte, level Level, seq uint64) int {
-	// Use unsafe for faster header writing
-	p := unsafe.Pointer(&buf[0])
-
-	// Magic
-	*(*uint32)(p) = MagicHeader
-
-	// Version and Level
-	*(*uint8)(unsafe.Add(p, 4)) = Version
-	*(*uint8)(unsafe.Add(p, 5)) = byte(level)
-
-	// Sequence
-	*(*uint64)(unsafe.Add(p, 6)) = seq
-
-	// Timestamp
-	*(*uint64)(unsafe.Add(p, 14)) = uint64(nanotime())
+func fieldSize(f *Field) int {
+	return fieldSizeDepth(f, 0)
+}
 
-	return 22
+// fieldSizeDepth returns the encoded size of a field nested depth levels
+// deep
+func fieldSizeDepth(f *Field, depth int) int {
+	if f.Type == fieldTypeLazy {
+		r := f.resolve()
+		return fieldSizeDepth(&r, depth)
+	}
+	size := 2 + len(f.Key) + 8
+	switch f.Type {
+	case FieldTypeString:
+		size += len(f.str)
+	case FieldTypeError:
+		size += f.errorPayloadSize()
+	case FieldTypeBytes:
+		size += int(f.num)
+	case FieldTypeObject, FieldTypeArray:
+		size += nestedSize(f, depth)
+	}
+	return size
 }
 
 // encodeField encodes a field to the buffer
+//
+//go:inline
 func encodeField(buf []byte, f *Field) int {
+	return encodeFieldDepth(buf, f, 0)
+}
+
+// encodeFieldDepth encodes a field nested depth levels deep
+func encodeFieldDepth(buf []byte, f *Field, depth int) int {
 	if len(buf) < 10 { // Minimum space needed
 		return 0
 	}
+	if f.Type == fieldTypeLazy {
+		r := f.resolve()
+		return encodeFieldDepth(buf, &r, depth)
+	}
 
 	pos := 0
 
@@ -262,9 +375,9 @@ func encodeField(buf []byte, f *Field) int {
 
 	// Value
 	switch f.Type {
-	case FieldTypeInt, FieldTypeUint, FieldTypeBool:
+	case FieldTypeInt, FieldTypeUint, FieldTypeBool, FieldTypeTime, FieldTypeDuration:
 		if len(buf)-pos < 8 {
-			return pos // Not enough space
+			return 0 // Not enough space
 		}
 		buf[pos] = byte(f.num >> 56)
 		buf[pos+1] = byte(f.num >> 48)
@@ -278,7 +391,7 @@ func encodeField(buf []byte, f *Field) int {
 
 	case FieldTypeFloat32:
 		if len(buf)-pos < 4 {
-			return pos
+			return 0
 		}
 		v := *(*uint32)(unsafe.Pointer(&f.num))
 		buf[pos] = byte(v >> 24)
@@ -289,7 +402,7 @@ func encodeField(buf []byte, f *Field) int {
 
 	case FieldTypeFloat64:
 		if len(buf)-pos < 8 {
-			return pos
+			return 0
 		}
 		buf[pos] = byte(f.num >> 56)
 		buf[pos+1] = byte(f.num >> 48)
@@ -303,7 +416,7 @@ func encodeField(buf []byte, f *Field) int {
 
 	case FieldTypeString:
 		if len(buf)-pos < 2 {
-			return pos
+			return 0
 		}
 		strLen := len(f.str)
 		maxLen := len(buf) - pos - 2
@@ -321,9 +434,34 @@ func encodeField(buf []byte, f *Field) int {
 			pos += strLen
 		}
 
+	case FieldTypeError:
+		// A cut payload would not decode, so it fits whole or not at all
+		size := f.errorPayloadSize()
+		if len(buf)-pos < 2+size {
+			return 0
+		}
+		if err, ok := f.obj.(error); ok {
+			size = encodeError(buf[pos+2:pos+2+size], err)
+			if size == 0 {
+				return 0
+			}
+		} else {
+			copy(buf[pos+2:], f.str)
+		}
+		buf[pos] = byte(size >> 8)
+		buf[pos+1] = byte(size)
+		pos += 2 + size
+
+	case FieldTypeObject, FieldTypeArray:
+		n := encodeNested(buf[pos:], f, depth)
+		if n == 0 {
+			return 0
+		}
+		pos += n
+
 	case FieldTypeBytes:
 		if len(buf)-pos < 2 {
-			return pos
+			return 0
 		}
 		dataLen := int(f.num)
 		maxLen := len(buf) - pos - 2
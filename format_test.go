@@ -0,0 +1,100 @@
+package zlog
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSetFormatMatchesWriters(t *testing.T) {
+	clock := ClockFunc(func() time.Time { return time.Unix(1700000000, 5) })
+
+	tests := []struct {
+		name   string
+		format LogFormat
+		writer func(io.Writer) io.Writer
+	}{
+		{"JSON", FormatJSON, func(w io.Writer) io.Writer { return NewJSONWriter(w) }},
+		{"Text", FormatText, func(w io.Writer) io.Writer { return NewLogfmtWriter(w) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := func(l *StructuredLogger) {
+				l.Info("hello world",
+					String("user", "jane doe"),
+					Int("id", 42),
+					Float64("ratio", 0.25),
+					Bool("admin", false),
+					Bytes("raw", []byte{0xca, 0xfe}))
+				l.WarnKV("kv", "count", 3, "name", "x")
+				l.Logger.Error("plain")
+			}
+
+			var decoded bytes.Buffer
+			viaWriter := NewStructured()
+			viaWriter.SetClock(clock)
+			viaWriter.SetWriter(tt.writer(&decoded))
+			log(viaWriter)
+
+			var direct bytes.Buffer
+			viaFormat := NewStructured()
+			viaFormat.SetClock(clock)
+			viaFormat.SetFormat(tt.format)
+			viaFormat.SetWriter(&direct)
+			log(viaFormat)
+
+			if viaFormat.GetFormat() != tt.format {
+				t.Errorf("GetFormat() = %v, want %v", viaFormat.GetFormat(), tt.format)
+			}
+			if direct.String() != decoded.String() {
+				t.Errorf("direct output differs from writer output\ndirect: %q\nwriter: %q",
+					direct.String(), decoded.String())
+			}
+		})
+	}
+}
+
+func TestSetFormatZeroAlloc(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful under the race detector")
+	}
+	for _, format := range []LogFormat{FormatJSON, FormatText} {
+		logger := NewStructured()
+		logger.SetWriter(io.Discard)
+		logger.SetFormat(format)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			logger.Info("request", String("path", "/api"), Int("status", 200), Bool("ok", true))
+		})
+		if allocs != 0 {
+			t.Errorf("format %d: %.1f allocs per log", format, allocs)
+		}
+	}
+}
+
+func BenchmarkStructuredLoggerJSON(b *testing.B) {
+	b.Run("Direct", func(b *testing.B) {
+		logger := NewStructured()
+		logger.SetWriter(io.Discard)
+		logger.SetFormat(FormatJSON)
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			logger.Info("benchmark", String("key1", "value1"), Int("key2", 42), Bool("key3", true))
+		}
+	})
+
+	b.Run("BinaryRoundTrip", func(b *testing.B) {
+		logger := NewStructured()
+		logger.SetWriter(NewJSONWriter(io.Discard))
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			logger.Info("benchmark", String("key1", "value1"), Int("key2", 42), Bool("key3", true))
+		}
+	})
+}
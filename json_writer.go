@@ -0,0 +1,219 @@
+package zlog
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// BytesEncoding selects how FieldTypeBytes values are rendered as text
+type BytesEncoding uint8
+
+const (
+	BytesBase64 BytesEncoding = iota // Standard base64 with padding
+	BytesHex                         // Lowercase hex
+)
+
+// JSONKeys names the record-level keys of a JSON object.
+// An empty name omits that entry.
+type JSONKeys struct {
+	Time     string
+	Level    string
+	Message  string
+	Sequence string
+	Caller   string
+	Stack    string
+}
+
+// DefaultJSONKeys are the keys used by a new JSONWriter
+var DefaultJSONKeys = JSONKeys{
+	Time:     "time",
+	Level:    "level",
+	Message:  "msg",
+	Sequence: "seq",
+	Caller:   "caller",
+	Stack:    "stack",
+}
+
+// JSONWriter decodes binary log format and outputs newline-delimited JSON
+type JSONWriter struct {
+	out  io.Writer
+	keys JSONKeys
+	enc  valueEncoding
+
+	// Pre-allocated buffer - reused for each write
+	buf []byte
+	mu  sync.Mutex
+}
+
+// NewJSONWriter creates a new JSON writer
+func NewJSONWriter(out io.Writer) *JSONWriter {
+	return &JSONWriter{
+		out:  out,
+		keys: DefaultJSONKeys,
+		buf:  make([]byte, 0, 2048), // Pre-allocate 2KB buffer
+	}
+}
+
+// SetKeys sets the names of the record-level keys
+func (w *JSONWriter) SetKeys(keys JSONKeys) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.keys = keys
+}
+
+// SetBytesEncoding sets how bytes fields are encoded
+func (w *JSONWriter) SetBytesEncoding(enc BytesEncoding) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.enc.bytes = enc
+}
+
+// SetTimeEncoding sets how time fields are encoded
+func (w *JSONWriter) SetTimeEncoding(enc TimeEncoding) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.enc.time = enc
+}
+
+// SetDurationEncoding sets how duration fields are encoded
+func (w *JSONWriter) SetDurationEncoding(enc DurationEncoding) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.enc.duration = enc
+}
+
+// Write decodes binary log and outputs one JSON object per record.
+// b may hold several consecutive records.
+func (w *JSONWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	buf := w.buf[:0]
+
+	var rec Record
+	for pos := 0; pos < len(b); {
+		n, err := DecodeRecord(b[pos:], &rec)
+		if err != nil {
+			return 0, err
+		}
+		pos += n
+		buf = w.appendRecord(buf, &rec)
+	}
+
+	// Save expanded buffer for reuse
+	w.buf = buf
+
+	_, err := w.out.Write(buf)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// appendRecord formats a decoded record as one JSON line
+func (w *JSONWriter) appendRecord(buf []byte, rec *Record) []byte {
+	buf = appendJSONHeader(buf, &w.keys, rec.Level, rec.Time, rec.Sequence, rec.Message)
+
+	fr := rec.fieldReader()
+	for {
+		f, ok := fr.next()
+		if !ok {
+			break
+		}
+		num, data := decodeValue(f.typ, f.val)
+		buf = appendJSONField(buf, f.key, f.typ, num, data, &w.enc)
+	}
+
+	if w.keys.Caller != "" {
+		var tmp [callerTextMax]byte
+		if caller, ok := rec.appendCaller(tmp[:0]); ok {
+			buf = appendJSONField(buf, StringToBytes(w.keys.Caller), FieldTypeString, 0, caller, &w.enc)
+		}
+	}
+	if stack := rec.Stack(); stack != nil && w.keys.Stack != "" {
+		buf = appendJSONField(buf, StringToBytes(w.keys.Stack), FieldTypeString, 0, stack, &w.enc)
+	}
+
+	return append(buf, '}', '\n')
+}
+
+// bigEndianUint64 decodes an 8-byte big-endian field value
+//
+//go:inline
+func bigEndianUint64(b []byte) uint64 {
+	_ = b[7]
+	return uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32 |
+		uint64(b[4])<<24 | uint64(b[5])<<16 | uint64(b[6])<<8 | uint64(b[7])
+}
+
+// appendJSONKey appends a separator if needed, the quoted key and a colon
+func appendJSONKey(buf []byte, key string, first *bool) []byte {
+	if !*first {
+		buf = append(buf, ',')
+	}
+	*first = false
+	buf = appendJSONString(buf, StringToBytes(key))
+	return append(buf, ':')
+}
+
+// appendJSONFloat appends a float; NaN and infinities become strings
+func appendJSONFloat(buf []byte, f float64, bitSize int) []byte {
+	switch {
+	case math.IsNaN(f):
+		return append(buf, `"NaN"`...)
+	case math.IsInf(f, 1):
+		return append(buf, `"+Inf"`...)
+	case math.IsInf(f, -1):
+		return append(buf, `"-Inf"`...)
+	}
+	return strconv.AppendFloat(buf, f, 'g', -1, bitSize)
+}
+
+// appendJSONString appends s as a quoted JSON string. Invalid UTF-8 is
+// replaced with U+FFFD.
+func appendJSONString(buf []byte, s []byte) []byte {
+	const hex = "0123456789abcdef"
+
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				buf = append(buf, '\\', c)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, "\ufffd"...)
+			i++
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf = append(buf, s[start:]...)
+	return append(buf, '"')
+}
@@ -0,0 +1,134 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONWriter(t *testing.T) {
+	fixed := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&out))
+	logger.SetClock(ClockFunc(func() time.Time { return fixed }))
+
+	logger.Warn("hello \"world\"\n",
+		Int("int", -42),
+		Uint64("uint", math.MaxUint64),
+		Float64("float", 2.5),
+		Float32("nan", float32(math.NaN())),
+		String("str", "tab\there \x01 \xff"),
+		Bool("ok", true),
+		Bytes("raw", []byte{0xde, 0xad, 0xbe, 0xef}))
+
+	line := out.String()
+	if !strings.HasSuffix(line, "}\n") || strings.Count(line, "\n") != 1 {
+		t.Fatalf("expected a single JSON line, got %q", line)
+	}
+
+	var got map[string]any
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", line, err)
+	}
+
+	want := map[string]string{
+		"time":  "2024-05-06T07:08:09.123456789Z",
+		"level": "warn",
+		"seq":   "1",
+		"msg":   "hello \"world\"\n",
+		"int":   "-42",
+		"uint":  "18446744073709551615",
+		"float": "2.5",
+		"nan":   "NaN",
+		"str":   "tab\there \x01 \ufffd",
+		"ok":    "true",
+		"raw":   "3q2+7w==",
+	}
+	for k, v := range want {
+		var s string
+		switch x := got[k].(type) {
+		case string:
+			s = x
+		case json.Number:
+			s = x.String()
+		case bool:
+			s = "false"
+			if x {
+				s = "true"
+			}
+		}
+		if s != v {
+			t.Errorf("%s = %q, want %q", k, s, v)
+		}
+	}
+}
+
+func TestJSONWriterOptions(t *testing.T) {
+	var out bytes.Buffer
+	jw := NewJSONWriter(&out)
+	jw.SetKeys(JSONKeys{Time: "", Level: "severity", Message: "message"})
+	jw.SetBytesEncoding(BytesHex)
+
+	logger := New()
+	logger.SetWriter(jw)
+	logger.Error("plain")
+
+	structured := NewStructured()
+	structured.SetWriter(jw)
+	structured.Info("bytes", Bytes("b", []byte{0x01, 0xab}))
+
+	want := `{"severity":"error","message":"plain"}` + "\n" +
+		`{"severity":"info","message":"bytes","b":"01ab"}` + "\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestJSONWriterZeroAlloc(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful under the race detector")
+	}
+	var raw bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&raw)
+	logger.Info("request", String("path", "/api"), Int("status", 200), Bytes("id", []byte{1, 2, 3}))
+	data := raw.Bytes()
+
+	jw := NewJSONWriter(io.Discard)
+	jw.Write(data) // warm up the buffer
+
+	allocs := testing.AllocsPerRun(100, func() {
+		jw.Write(data)
+	})
+	if allocs != 0 {
+		t.Errorf("JSONWriter.Write allocated %.1f times per record", allocs)
+	}
+}
+
+func BenchmarkJSONWriter(b *testing.B) {
+	var raw bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&raw)
+	logger.Info("Request handled",
+		String("method", "POST"),
+		String("path", "/api/users"),
+		Int("status", 200),
+		Float64("duration", 1.234))
+	data := raw.Bytes()
+
+	jw := NewJSONWriter(io.Discard)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		jw.Write(data)
+	}
+}
@@ -0,0 +1,100 @@
+package zlog
+
+import "fmt"
+
+// fieldTypeLazy marks a field whose value is computed when the record is
+// written. Lazy fields are resolved before encoding, so the type never
+// appears in records.
+const fieldTypeLazy FieldType = 255
+
+// Lazy creates a field whose value is produced by fn when the record is
+// written. fn is not called for records below the logger's level, and is
+// called once for each record otherwise; with With it is called once, when
+// the child logger is created. The field returned by fn is logged under
+// key.
+func Lazy(key string, fn func() Field) Field {
+	return Field{Key: key, Type: fieldTypeLazy, obj: fn}
+}
+
+// Func creates an object field filled in by fn when the record is written.
+// Like MarshalLogObject, fn may be called more than once per record, so it
+// must add the same fields each time.
+func Func(key string, fn func(enc ObjectEncoder)) Field {
+	return Object(key, objectFunc(fn))
+}
+
+// Stringer creates a string field holding val.String(), called when the
+// record is written
+func Stringer(key string, val fmt.Stringer) Field {
+	return Field{Key: key, Type: fieldTypeLazy, obj: val}
+}
+
+// objectFunc adapts a function to ObjectMarshaler
+type objectFunc func(enc ObjectEncoder)
+
+// MarshalLogObject calls the function
+func (fn objectFunc) MarshalLogObject(enc ObjectEncoder) error {
+	if fn != nil {
+		fn(enc)
+	}
+	return nil
+}
+
+// resolve returns the field a lazy field stands for, under its key
+func (f *Field) resolve() Field {
+	r := *f
+	for i := 0; r.Type == fieldTypeLazy; i++ {
+		switch v := r.obj.(type) {
+		case func() Field:
+			if v == nil || i == maxNestingDepth {
+				r = String(f.Key, "<nil>")
+				break
+			}
+			r = v()
+		case fmt.Stringer:
+			if isNilPointer(v) {
+				r = String(f.Key, "<nil>")
+				break
+			}
+			r = String(f.Key, v.String())
+		default:
+			r = String(f.Key, "<nil>")
+		}
+	}
+	r.Key = f.Key
+	return r
+}
+
+// resolveFields returns fields with lazy values computed and errors
+// encoded, their payloads appended to payloads. If there are any, the
+// fields are copied to buf first so the caller's fields stay unresolved
+// and each value is computed once per record.
+func resolveFields(buf []Field, payloads *[]byte, fields []Field) []Field {
+	for i := range fields {
+		if !fields[i].unresolved() {
+			continue
+		}
+		buf = append(buf, fields...)
+		for j := i; j < len(buf); j++ {
+			f := &buf[j]
+			if f.Type == fieldTypeLazy {
+				*f = f.resolve()
+			}
+			if err, ok := f.obj.(error); ok && f.Type == FieldTypeError {
+				start := len(*payloads)
+				*payloads = appendError(*payloads, err)
+				f.str = BytesToString((*payloads)[start:])
+				f.obj = nil
+			}
+		}
+		return buf
+	}
+	return fields
+}
+
+// unresolved reports whether f is lazy or an error that is not encoded yet
+//
+//go:inline
+func (f *Field) unresolved() bool {
+	return f.Type == fieldTypeLazy || f.Type == FieldTypeError && f.obj != nil
+}
@@ -0,0 +1,130 @@
+package zlog
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type countingStringer struct{ calls *int }
+
+func (s countingStringer) String() string {
+	*s.calls++
+	return "expensive"
+}
+
+func TestLazyDisabled(t *testing.T) {
+	logger := NewStructured()
+	logger.SetWriter(io.Discard)
+	logger.SetLevel(LevelInfo)
+
+	calls := 0
+	logger.Debug("skipped",
+		Lazy("dump", func() Field { calls++; return String("", "x") }),
+		Func("obj", func(enc ObjectEncoder) { calls++ }),
+		Stringer("s", countingStringer{&calls}))
+	logger.DebugKV("skipped", "s", Stringer("", countingStringer{&calls}))
+	if calls != 0 {
+		t.Errorf("lazy values computed %d times for a disabled record", calls)
+	}
+}
+
+func TestLazyEnabled(t *testing.T) {
+	for _, format := range []LogFormat{FormatBinary, FormatJSON} {
+		var buf bytes.Buffer
+		logger := NewStructured()
+		logger.SetFormat(format)
+		if format == FormatBinary {
+			logger.SetWriter(NewJSONWriter(&buf))
+		} else {
+			logger.SetWriter(&buf)
+		}
+
+		lazyCalls, stringerCalls := 0, 0
+		fields := []Field{
+			Lazy("dump", func() Field { lazyCalls++; return Int("ignored", 42) }),
+			Stringer("s", countingStringer{&stringerCalls}),
+			Func("obj", func(enc ObjectEncoder) { enc.AddString("k", "v") }),
+		}
+		logger.Info("first", fields...)
+		logger.Info("second", fields...)
+
+		if lazyCalls != 2 || stringerCalls != 2 {
+			t.Errorf("format %d: computed %d and %d times over two records, want once per record", format, lazyCalls, stringerCalls)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if !strings.HasSuffix(line, `"dump":42,"s":"expensive","obj":{"k":"v"}}`) {
+				t.Errorf("format %d: unexpected output %s", format, line)
+			}
+		}
+	}
+}
+
+func TestStringerNilPointer(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&buf))
+	logger.Info("m", Stringer("svc", (*testNilStringer)(nil)), Stringer("none", nil))
+
+	if !strings.HasSuffix(buf.String(), `"svc":"<nil>","none":"<nil>"}`+"\n") {
+		t.Errorf("unexpected output %s", buf.String())
+	}
+}
+
+func TestLazyManyFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&buf))
+
+	var fields []Field
+	for i := 0; i < 2*stackFieldCount; i++ {
+		fields = append(fields, Int("i"+strconv.Itoa(i), i))
+	}
+	fields = append(fields, Lazy("last", func() Field { return String("", "computed") }))
+	logger.Info("m", fields...)
+
+	if !strings.HasSuffix(buf.String(), `"i31":31,"last":"computed"}`+"\n") {
+		t.Errorf("unexpected output %s", buf.String())
+	}
+}
+
+func TestLazyNested(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&buf))
+
+	calls := 0
+	child := logger.With(Lazy("svc", func() Field { calls++; return String("", strings.Repeat("api", calls)) }))
+	child.Info("m", Func("req", func(enc ObjectEncoder) {
+		enc.AddField(Lazy("id", func() Field { return Int("", 7) }))
+	}), Lazy("nil", nil), Stringer("none", nil))
+
+	if !strings.HasSuffix(buf.String(), `"svc":"api","req":{"id":7},"nil":"<nil>","none":"<nil>"}`+"\n") {
+		t.Errorf("unexpected output %s", buf.String())
+	}
+	if calls != 1 {
+		t.Errorf("With computed the lazy value %d times, want once", calls)
+	}
+}
+
+func TestLazyDisabledZeroAlloc(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful under the race detector")
+	}
+	logger := NewStructured()
+	logger.SetWriter(io.Discard)
+	logger.SetLevel(LevelInfo)
+	str := &testStringer{"svc"}
+
+	// A closure that captures variables would be allocated by the call
+	allocs := testing.AllocsPerRun(100, func() {
+		logger.Debug("skipped", Lazy("dump", lazyDump), Stringer("s", str))
+	})
+	if allocs != 0 {
+		t.Errorf("%.1f allocs per disabled log", allocs)
+	}
+}
+
+func lazyDump() Field { return String("", "dump") }
@@ -1,19 +1,15 @@
 package zlog
 
 import (
-	"encoding/binary"
-	"fmt"
 	"io"
-	"strconv"
 	"sync"
-	"time"
-	"unsafe"
 )
 
 // LogfmtWriter decodes binary log format and outputs logfmt format
 // logfmt is human-readable and machine-parseable: key=value pairs
 type LogfmtWriter struct {
 	out io.Writer
+	enc valueEncoding
 	buf sync.Pool
 }
 
@@ -29,36 +25,21 @@ func NewLogfmtWriter(out io.Writer) *LogfmtWriter {
 	}
 }
 
-// Write decodes binary log and outputs logfmt format
-func (w *LogfmtWriter) Write(b []byte) (int, error) {
-	if len(b) < 22 { // Minimum header size
-		return 0, fmt.Errorf("invalid log entry: too short")
-	}
-
-	// Decode binary header
-	magic := binary.LittleEndian.Uint32(b[0:4])
-	if magic != MagicHeader {
-		return 0, fmt.Errorf("invalid magic header")
-	}
-
-	// version := b[4]
-	level := Level(b[5])
-	// seq := binary.LittleEndian.Uint64(b[6:14])
-	timestamp := binary.LittleEndian.Uint64(b[14:22])
-
-	pos := 22
+// SetTimeEncoding sets how time fields are encoded. Set it before the
+// writer is in use.
+func (w *LogfmtWriter) SetTimeEncoding(enc TimeEncoding) {
+	w.enc.time = enc
+}
 
-	// Get message
-	var msg string
-	if pos < len(b) {
-		msgLen := int(b[pos])
-		pos++
-		if pos+msgLen <= len(b) {
-			msg = string(b[pos : pos+msgLen])
-			pos += msgLen
-		}
-	}
+// SetDurationEncoding sets how duration fields are encoded. Set it before
+// the writer is in use.
+func (w *LogfmtWriter) SetDurationEncoding(enc DurationEncoding) {
+	w.enc.duration = enc
+}
 
+// Write decodes binary log and outputs logfmt format.
+// b may hold several consecutive records.
+func (w *LogfmtWriter) Write(b []byte) (int, error) {
 	// Get buffer from pool
 	bufInterface := w.buf.Get()
 	buf := bufInterface.([]byte)
@@ -67,55 +48,16 @@ func (w *LogfmtWriter) Write(b []byte) (int, error) {
 		w.buf.Put(buf)
 	}()
 
-	// Format timestamp
-	t := time.Unix(0, int64(timestamp))
-	buf = append(buf, "time="...)
-	buf = t.AppendFormat(buf, time.RFC3339)
-
-	// Add level
-	buf = append(buf, " level="...)
-	buf = append(buf, getLevelString(level)...)
-
-	// Add message
-	buf = append(buf, " msg="...)
-	buf = appendQuoted(buf, msg)
-
-	// Decode fields if present
-	if pos < len(b) {
-		fieldCount := int(b[pos])
-		pos++
-
-		for i := 0; i < fieldCount && pos < len(b); i++ {
-			// Decode field key
-			keyLen := int(b[pos])
-			pos++
-			if pos+keyLen > len(b) {
-				break
-			}
-			key := string(b[pos : pos+keyLen])
-			pos += keyLen
-
-			if pos >= len(b) {
-				break
-			}
-
-			fieldType := FieldType(b[pos])
-			pos++
-
-			// Add key
-			buf = append(buf, ' ')
-			buf = append(buf, key...)
-			buf = append(buf, '=')
-
-			// Decode and format value
-			value := w.decodeFieldValue(b[pos:], fieldType)
-			buf = append(buf, value...)
-			pos += w.fieldValueSize(b[pos:], fieldType)
+	var rec Record
+	for pos := 0; pos < len(b); {
+		n, err := DecodeRecord(b[pos:], &rec)
+		if err != nil {
+			return 0, err
 		}
+		pos += n
+		buf = w.appendRecord(buf, &rec)
 	}
 
-	buf = append(buf, '\n')
-
 	// Write to output
 	_, err := w.out.Write(buf)
 	if err != nil {
@@ -124,6 +66,32 @@ func (w *LogfmtWriter) Write(b []byte) (int, error) {
 	return len(b), nil
 }
 
+// appendRecord formats a decoded record as one logfmt line
+func (w *LogfmtWriter) appendRecord(buf []byte, rec *Record) []byte {
+	buf = appendLogfmtHeader(buf, rec.Level, rec.Time, rec.Message)
+
+	// Decode fields
+	fr := rec.fieldReader()
+	for {
+		f, ok := fr.next()
+		if !ok {
+			break
+		}
+		num, data := decodeValue(f.typ, f.val)
+		buf = appendLogfmtField(buf, f.key, f.typ, num, data, &w.enc)
+	}
+
+	var tmp [callerTextMax]byte
+	if caller, ok := rec.appendCaller(tmp[:0]); ok {
+		buf = appendLogfmtField(buf, callerKey, FieldTypeString, 0, caller, &w.enc)
+	}
+	if stack := rec.Stack(); stack != nil {
+		buf = appendLogfmtField(buf, stackKey, FieldTypeString, 0, stack, &w.enc)
+	}
+
+	return append(buf, '\n')
+}
+
 // getLevelString returns the string representation of a level
 func getLevelString(level Level) string {
 	switch level {
@@ -146,7 +114,7 @@ func getLevelString(level Level) string {
 func appendQuoted(buf []byte, s string) []byte {
 	needsQuotes := false
 	for _, c := range s {
-		if c == ' ' || c == '"' || c == '=' || c == '\n' || c == '\r' {
+		if c == ' ' || c == '"' || c == '=' || c == '\n' || c == '\r' || c == '\t' {
 			needsQuotes = true
 			break
 		}
@@ -167,6 +135,8 @@ func appendQuoted(buf []byte, s string) []byte {
 			buf = append(buf, '\\', 'n')
 		} else if c == '\r' {
 			buf = append(buf, '\\', 'r')
+		} else if c == '\t' {
+			buf = append(buf, '\\', 't')
 		} else {
 			buf = append(buf, byte(c))
 		}
@@ -174,103 +144,3 @@ func appendQuoted(buf []byte, s string) []byte {
 	buf = append(buf, '"')
 	return buf
 }
-
-// decodeFieldValue decodes a field value to string
-func (w *LogfmtWriter) decodeFieldValue(b []byte, fieldType FieldType) string {
-	switch fieldType {
-	case FieldTypeInt:
-		if len(b) < 8 {
-			return "?"
-		}
-		// Big endian decoding to match encoding
-		v := uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32 |
-			uint64(b[4])<<24 | uint64(b[5])<<16 | uint64(b[6])<<8 | uint64(b[7])
-		return strconv.FormatInt(int64(v), 10)
-
-	case FieldTypeUint:
-		if len(b) < 8 {
-			return "?"
-		}
-		// Big endian decoding to match encoding
-		v := uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32 |
-			uint64(b[4])<<24 | uint64(b[5])<<16 | uint64(b[6])<<8 | uint64(b[7])
-		return strconv.FormatUint(v, 10)
-
-	case FieldTypeFloat32:
-		if len(b) < 4 {
-			return "?"
-		}
-		// Big endian decoding
-		v := uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
-		f := *(*float32)(unsafe.Pointer(&v))
-		return strconv.FormatFloat(float64(f), 'g', -1, 32)
-
-	case FieldTypeFloat64:
-		if len(b) < 8 {
-			return "?"
-		}
-		// Big endian decoding
-		v := uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32 |
-			uint64(b[4])<<24 | uint64(b[5])<<16 | uint64(b[6])<<8 | uint64(b[7])
-		f := *(*float64)(unsafe.Pointer(&v))
-		return strconv.FormatFloat(f, 'g', -1, 64)
-
-	case FieldTypeString:
-		if len(b) < 2 {
-			return "?"
-		}
-		// Big endian decoding for string length
-		slen := int(uint16(b[0])<<8 | uint16(b[1]))
-		if len(b) < 2+slen {
-			return "?"
-		}
-		// Quote if needed
-		var buf []byte
-		return string(appendQuoted(buf, string(b[2:2+slen])))
-
-	case FieldTypeBool:
-		if len(b) < 8 {
-			return "?"
-		}
-		// Big endian decoding
-		v := uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32 |
-			uint64(b[4])<<24 | uint64(b[5])<<16 | uint64(b[6])<<8 | uint64(b[7])
-		if v != 0 {
-			return "true"
-		}
-		return "false"
-
-	case FieldTypeBytes:
-		if len(b) < 2 {
-			return "?"
-		}
-		// Big endian decoding for bytes length
-		blen := int(uint16(b[0])<<8 | uint16(b[1]))
-		if len(b) < 2+blen {
-			return "?"
-		}
-		// Format as hex string
-		return fmt.Sprintf("%x", b[2:2+blen])
-
-	default:
-		return "?"
-	}
-}
-
-// fieldValueSize returns the size of a field value in bytes
-func (w *LogfmtWriter) fieldValueSize(b []byte, fieldType FieldType) int {
-	switch fieldType {
-	case FieldTypeInt, FieldTypeUint, FieldTypeFloat64, FieldTypeBool:
-		return 8
-	case FieldTypeFloat32:
-		return 4
-	case FieldTypeString, FieldTypeBytes:
-		if len(b) < 2 {
-			return 2
-		}
-		// Big endian decoding for length
-		return 2 + int(uint16(b[0])<<8|uint16(b[1]))
-	default:
-		return 0
-	}
-}
@@ -0,0 +1,395 @@
+package zlog
+
+import (
+	"sync"
+	"time"
+)
+
+// maxNestingDepth bounds how deep objects and arrays nest. Deeper values
+// are recorded as empty.
+const maxNestingDepth = 16
+
+// maxNestedSize bounds the encoded size of one object or array
+const maxNestedSize = 65535 - 2
+
+// ObjectMarshaler is implemented by types that log themselves as an object
+// of typed fields. MarshalLogObject may be called more than once per
+// record, so it must add the same fields each time.
+type ObjectMarshaler interface {
+	MarshalLogObject(enc ObjectEncoder) error
+}
+
+// ArrayMarshaler is implemented by types that log themselves as an array.
+// MarshalLogArray may be called more than once per record, so it must
+// append the same elements each time.
+type ArrayMarshaler interface {
+	MarshalLogArray(enc ArrayEncoder) error
+}
+
+// ObjectEncoder adds typed fields to an object
+type ObjectEncoder interface {
+	AddString(key, val string)
+	AddInt(key string, val int)
+	AddInt64(key string, val int64)
+	AddUint64(key string, val uint64)
+	AddFloat64(key string, val float64)
+	AddBool(key string, val bool)
+	AddBytes(key string, val []byte)
+	AddTime(key string, val time.Time)
+	AddDuration(key string, val time.Duration)
+	AddObject(key string, val ObjectMarshaler)
+	AddArray(key string, val ArrayMarshaler)
+	AddAny(key string, val any)
+	AddField(f Field)
+}
+
+// ArrayEncoder appends typed elements to an array
+type ArrayEncoder interface {
+	AppendString(val string)
+	AppendInt(val int)
+	AppendInt64(val int64)
+	AppendUint64(val uint64)
+	AppendFloat64(val float64)
+	AppendBool(val bool)
+	AppendTime(val time.Time)
+	AppendDuration(val time.Duration)
+	AppendObject(val ObjectMarshaler)
+	AppendArray(val ArrayMarshaler)
+	AppendAny(val any)
+}
+
+// Object creates a field holding the fields added by val. Nothing is
+// marshaled unless the record is logged.
+//
+//go:inline
+func Object(key string, val ObjectMarshaler) Field {
+	return Field{Key: key, Type: FieldTypeObject, obj: val}
+}
+
+// Array creates a field holding the elements appended by val. Nothing is
+// marshaled unless the record is logged.
+//
+//go:inline
+func Array(key string, val ArrayMarshaler) Field {
+	return Field{Key: key, Type: FieldTypeArray, obj: val}
+}
+
+// fieldEncoder implements ObjectEncoder and ArrayEncoder. An object or
+// array value is a field count (uint16 BE) followed by encoded fields;
+// array elements have empty keys. With a nil buf the encoder only adds up
+// sizes.
+type fieldEncoder struct {
+	buf   []byte
+	pos   int
+	count int
+	depth int
+}
+
+var fieldEncoderPool = sync.Pool{
+	New: func() any { return new(fieldEncoder) },
+}
+
+// marshalNested runs f's marshaler into buf, or sizes it if buf is nil,
+// and returns the bytes used and the number of fields
+func marshalNested(buf []byte, f *Field, depth int) (int, int) {
+	if depth >= maxNestingDepth || f.obj == nil {
+		return 0, 0
+	}
+
+	e := fieldEncoderPool.Get().(*fieldEncoder)
+	e.buf, e.pos, e.count, e.depth = buf, 0, 0, depth
+
+	var err error
+	switch m := f.obj.(type) {
+	case ObjectMarshaler:
+		err = m.MarshalLogObject(e)
+	case ArrayMarshaler:
+		err = m.MarshalLogArray(e)
+	}
+	if err != nil {
+		e.AddField(Err(err))
+	}
+
+	n, count := e.pos, e.count
+	e.buf = nil
+	fieldEncoderPool.Put(e)
+	return n, count
+}
+
+// nestedSize returns the encoded size of an object or array value,
+// including its length prefix and field count
+func nestedSize(f *Field, depth int) int {
+	n, _ := marshalNested(nil, f, depth)
+	return 4 + n
+}
+
+// encodeNested encodes an object or array value with its length prefix and
+// field count. Fields that do not fit are dropped.
+func encodeNested(buf []byte, f *Field, depth int) int {
+	if len(buf) < 4 {
+		return 0
+	}
+	limit := len(buf)
+	if limit > 2+maxNestedSize {
+		limit = 2 + maxNestedSize
+	}
+	n, count := marshalNested(buf[4:limit], f, depth)
+	size := 2 + n
+	buf[0] = byte(size >> 8)
+	buf[1] = byte(size)
+	buf[2] = byte(count >> 8)
+	buf[3] = byte(count)
+	return 4 + n
+}
+
+// add encodes a field at the next position
+func (e *fieldEncoder) add(f *Field) {
+	if e.count == maxFieldCount {
+		return
+	}
+	if e.buf == nil {
+		e.pos += fieldSizeDepth(f, e.depth+1)
+		e.count++
+		return
+	}
+	if n := encodeFieldDepth(e.buf[e.pos:], f, e.depth+1); n > 0 {
+		e.pos += n
+		e.count++
+	}
+}
+
+// AddString adds a field to the object
+func (e *fieldEncoder) AddString(key, val string) {
+	f := String(key, val)
+	e.add(&f)
+}
+
+// AddInt adds a field to the object
+func (e *fieldEncoder) AddInt(key string, val int) {
+	f := Int(key, val)
+	e.add(&f)
+}
+
+// AddInt64 adds a field to the object
+func (e *fieldEncoder) AddInt64(key string, val int64) {
+	f := Int64(key, val)
+	e.add(&f)
+}
+
+// AddUint64 adds a field to the object
+func (e *fieldEncoder) AddUint64(key string, val uint64) {
+	f := Uint64(key, val)
+	e.add(&f)
+}
+
+// AddFloat64 adds a field to the object
+func (e *fieldEncoder) AddFloat64(key string, val float64) {
+	f := Float64(key, val)
+	e.add(&f)
+}
+
+// AddBool adds a field to the object
+func (e *fieldEncoder) AddBool(key string, val bool) {
+	f := Bool(key, val)
+	e.add(&f)
+}
+
+// AddBytes adds a field to the object
+func (e *fieldEncoder) AddBytes(key string, val []byte) {
+	f := Bytes(key, val)
+	e.add(&f)
+}
+
+// AddTime adds a field to the object
+func (e *fieldEncoder) AddTime(key string, val time.Time) {
+	f := Time(key, val)
+	e.add(&f)
+}
+
+// AddDuration adds a field to the object
+func (e *fieldEncoder) AddDuration(key string, val time.Duration) {
+	f := Duration(key, val)
+	e.add(&f)
+}
+
+// AddObject adds a field to the object
+func (e *fieldEncoder) AddObject(key string, val ObjectMarshaler) {
+	f := Object(key, val)
+	e.add(&f)
+}
+
+// AddArray adds a field to the object
+func (e *fieldEncoder) AddArray(key string, val ArrayMarshaler) {
+	f := Array(key, val)
+	e.add(&f)
+}
+
+// AddAny adds a field of the type that fits val, as chosen by Any
+func (e *fieldEncoder) AddAny(key string, val any) {
+	f := Any(key, val)
+	e.add(&f)
+}
+
+// AddField adds any field to the object
+func (e *fieldEncoder) AddField(f Field) {
+	e.add(&f)
+}
+
+// AppendString appends an element to the array
+func (e *fieldEncoder) AppendString(val string) {
+	e.AddString("", val)
+}
+
+// AppendInt appends an element to the array
+func (e *fieldEncoder) AppendInt(val int) {
+	e.AddInt("", val)
+}
+
+// AppendInt64 appends an element to the array
+func (e *fieldEncoder) AppendInt64(val int64) {
+	e.AddInt64("", val)
+}
+
+// AppendUint64 appends an element to the array
+func (e *fieldEncoder) AppendUint64(val uint64) {
+	e.AddUint64("", val)
+}
+
+// AppendFloat64 appends an element to the array
+func (e *fieldEncoder) AppendFloat64(val float64) {
+	e.AddFloat64("", val)
+}
+
+// AppendBool appends an element to the array
+func (e *fieldEncoder) AppendBool(val bool) {
+	e.AddBool("", val)
+}
+
+// AppendTime appends an element to the array
+func (e *fieldEncoder) AppendTime(val time.Time) {
+	e.AddTime("", val)
+}
+
+// AppendDuration appends an element to the array
+func (e *fieldEncoder) AppendDuration(val time.Duration) {
+	e.AddDuration("", val)
+}
+
+// AppendObject appends an element to the array
+func (e *fieldEncoder) AppendObject(val ObjectMarshaler) {
+	e.AddObject("", val)
+}
+
+// AppendArray appends an element to the array
+func (e *fieldEncoder) AppendArray(val ArrayMarshaler) {
+	e.AddArray("", val)
+}
+
+// AppendAny appends an element of the type that fits val, as chosen by Any
+func (e *fieldEncoder) AppendAny(val any) {
+	e.AddAny("", val)
+}
+
+// nestedReader returns a reader over the fields of a decoded object or
+// array value
+func nestedReader(data []byte) fieldReader {
+	if len(data) < 2 {
+		return fieldReader{}
+	}
+	return fieldReader{b: data[2:], n: int(uint16(data[0])<<8 | uint16(data[1]))}
+}
+
+// isNested reports whether t holds an object or array
+//
+//go:inline
+func isNested(t FieldType) bool {
+	return t == FieldTypeObject || t == FieldTypeArray
+}
+
+// encodeNestedValue encodes an object, array or unencoded error field into
+// a pooled buffer for the text encoders and returns its value payload. The
+// buffer must be returned with PutBuffer.
+func encodeNestedValue(f *Field) ([]byte, *[]byte) {
+	size := fieldSize(f)
+	bufPtr := GetBuffer(size)
+	buf := (*bufPtr)[:size]
+	n := encodeField(buf, f)
+
+	fr := fieldReader{b: buf[:n], n: 1}
+	raw, ok := fr.next()
+	if !ok {
+		return nil, bufPtr
+	}
+	_, data := decodeValue(raw.typ, raw.val)
+	return data, bufPtr
+}
+
+// appendJSONNested renders an object as a JSON object and an array as a
+// JSON array
+func appendJSONNested(buf []byte, t FieldType, data []byte, enc *valueEncoding) []byte {
+	fr := nestedReader(data)
+	if t == FieldTypeArray {
+		buf = append(buf, '[')
+		for i := 0; ; i++ {
+			f, ok := fr.next()
+			if !ok {
+				break
+			}
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			num, data := decodeValue(f.typ, f.val)
+			buf = appendJSONValue(buf, f.typ, num, data, enc)
+		}
+		return append(buf, ']')
+	}
+
+	buf = append(buf, '{')
+	for {
+		f, ok := fr.next()
+		if !ok {
+			break
+		}
+		num, data := decodeValue(f.typ, f.val)
+		buf = appendJSONField(buf, f.key, f.typ, num, data, enc)
+	}
+	return append(buf, '}')
+}
+
+// appendLogfmtNested flattens an object or array into pairs with dotted
+// keys, key.sub for object fields and key.0 for array elements. An empty
+// value is rendered as key={} or key=[].
+func appendLogfmtNested(buf []byte, key []byte, t FieldType, data []byte, enc *valueEncoding) []byte {
+	fr := nestedReader(data)
+	if fr.n == 0 {
+		buf = append(buf, ' ')
+		buf = append(buf, key...)
+		if t == FieldTypeArray {
+			return append(buf, "=[]"...)
+		}
+		return append(buf, "={}"...)
+	}
+
+	var keyBuf [128]byte
+	for i := 0; ; i++ {
+		f, ok := fr.next()
+		if !ok {
+			break
+		}
+		sub := appendNestedKey(keyBuf[:0], key, t, f.key, i)
+		num, data := decodeValue(f.typ, f.val)
+		buf = appendLogfmtField(buf, sub, f.typ, num, data, enc)
+	}
+	return buf
+}
+
+// appendNestedKey appends the dotted key of a nested field: key.sub in an
+// object, key.i in an array
+func appendNestedKey(buf []byte, key []byte, t FieldType, sub []byte, i int) []byte {
+	buf = append(buf, key...)
+	buf = append(buf, '.')
+	if t == FieldTypeArray {
+		return appendInt(buf, int64(i))
+	}
+	return append(buf, sub...)
+}
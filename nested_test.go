@@ -0,0 +1,212 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testRequest struct {
+	method  string
+	path    string
+	status  int
+	latency time.Duration
+	tags    testTags
+}
+
+func (r *testRequest) MarshalLogObject(enc ObjectEncoder) error {
+	enc.AddString("method", r.method)
+	enc.AddString("path", r.path)
+	enc.AddInt("status", r.status)
+	enc.AddDuration("latency", r.latency)
+	enc.AddArray("tags", &r.tags) // A pointer converts without allocating
+	return nil
+}
+
+type testTags []string
+
+func (t testTags) MarshalLogArray(enc ArrayEncoder) error {
+	for _, s := range t {
+		enc.AppendString(s)
+	}
+	return nil
+}
+
+type testIDs []int64
+
+func (ids testIDs) MarshalLogArray(enc ArrayEncoder) error {
+	for _, id := range ids {
+		enc.AppendInt64(id)
+	}
+	return nil
+}
+
+// testDeep nests itself n levels deep
+type testDeep int
+
+func (d testDeep) MarshalLogObject(enc ObjectEncoder) error {
+	enc.AddInt("level", int(d))
+	if d > 0 {
+		enc.AddObject("next", d-1)
+	}
+	return nil
+}
+
+type testFailing struct{}
+
+func (testFailing) MarshalLogObject(enc ObjectEncoder) error {
+	enc.AddBool("partial", true)
+	return errors.New("marshal failed")
+}
+
+var testReq = &testRequest{
+	method:  "GET",
+	path:    "/users",
+	status:  200,
+	latency: 1500 * time.Microsecond,
+	tags:    testTags{"a", "b c"},
+}
+
+func TestNestedJSON(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&out))
+	logger.Info("request", Object("req", testReq), Array("ids", testIDs{1, 2, 3}))
+
+	want := `"req":{"method":"GET","path":"/users","status":200,"latency":"1.5ms","tags":["a","b c"]},"ids":[1,2,3]}`
+	if !strings.HasSuffix(out.String(), want+"\n") {
+		t.Errorf("got %q, want suffix %q", out.String(), want)
+	}
+	if !json.Valid(out.Bytes()) {
+		t.Errorf("invalid JSON %q", out.String())
+	}
+}
+
+func TestNestedLogfmt(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewLogfmtWriter(&out))
+	logger.Info("request", Object("req", testReq), Array("ids", testIDs{}))
+
+	want := ` req.method=GET req.path=/users req.status=200 req.latency=1.5ms req.tags.0=a req.tags.1="b c" ids=[]`
+	if !strings.HasSuffix(out.String(), want+"\n") {
+		t.Errorf("got %q, want suffix %q", out.String(), want)
+	}
+}
+
+func TestNestedTerminal(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewTerminalWriter(&out))
+	logger.Info("request", Object("req", testReq), Int("n", 1))
+
+	want := `req.method=GET req.path=/users req.status=200 req.latency=1.5ms req.tags.0=a req.tags.1="b c" n=1`
+	if !strings.HasSuffix(out.String(), want+"\n") {
+		t.Errorf("got %q, want suffix %q", out.String(), want)
+	}
+}
+
+func TestNestedDepthBounded(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&out))
+	logger.Info("deep", Object("d", testDeep(100)))
+
+	if !json.Valid(out.Bytes()) {
+		t.Fatalf("invalid JSON %q", out.String())
+	}
+	if got := strings.Count(out.String(), `{"level":`); got != maxNestingDepth {
+		t.Errorf("recorded %d levels, want %d", got, maxNestingDepth)
+	}
+}
+
+func TestNestedMarshalError(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&out))
+	logger.Info("failing", Object("obj", testFailing{}))
+
+	want := `"obj":{"partial":true,"error":{"message":"marshal failed","type":"*errors.errorString"}}}`
+	if !strings.HasSuffix(out.String(), want+"\n") {
+		t.Errorf("got %q, want suffix %q", out.String(), want)
+	}
+}
+
+func TestNestedDirectFormats(t *testing.T) {
+	clock := ClockFunc(func() time.Time { return time.Unix(1700000000, 0) })
+	for _, tt := range []struct {
+		format LogFormat
+		writer func(io.Writer) io.Writer
+	}{
+		{FormatJSON, func(w io.Writer) io.Writer { return NewJSONWriter(w) }},
+		{FormatText, func(w io.Writer) io.Writer { return NewLogfmtWriter(w) }},
+	} {
+		var decoded, direct bytes.Buffer
+
+		viaWriter := NewStructured()
+		viaWriter.SetClock(clock)
+		viaWriter.SetWriter(tt.writer(&decoded))
+		viaWriter.With(Array("ids", testIDs{7})).Info("r", Object("req", testReq), Bytes("empty", nil))
+
+		viaFormat := NewStructured()
+		viaFormat.SetClock(clock)
+		viaFormat.SetFormat(tt.format)
+		viaFormat.SetWriter(&direct)
+		viaFormat.With(Array("ids", testIDs{7})).Info("r", Object("req", testReq), Bytes("empty", nil))
+
+		if direct.String() != decoded.String() {
+			t.Errorf("format %d: direct %q, writer %q", tt.format, direct.String(), decoded.String())
+		}
+	}
+}
+
+func TestNestedZeroAlloc(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful under the race detector")
+	}
+	logger := NewStructured()
+	logger.SetWriter(io.Discard)
+	logger.SetFormat(FormatJSON)
+	ids := &testIDs{1, 2, 3}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		logger.Info("request", Object("req", testReq), Array("ids", ids))
+	})
+	if allocs != 0 {
+		t.Errorf("%.1f allocs per log", allocs)
+	}
+}
+
+func TestNestedSkippedWhenDisabled(t *testing.T) {
+	logger := NewStructured()
+	logger.SetWriter(io.Discard)
+	logger.SetLevel(LevelError)
+
+	calls := 0
+	logger.Info("filtered", Object("obj", countingMarshaler{&calls}))
+	if calls != 0 {
+		t.Errorf("marshaler ran %d times for a filtered record", calls)
+	}
+}
+
+type countingMarshaler struct{ calls *int }
+
+func (c countingMarshaler) MarshalLogObject(enc ObjectEncoder) error {
+	*c.calls++
+	return nil
+}
+
+func BenchmarkNestedObject(b *testing.B) {
+	logger := NewStructured()
+	logger.SetWriter(io.Discard)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("request", Object("req", testReq))
+	}
+}
@@ -0,0 +1,95 @@
+package zlog
+
+import (
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// panicFields holds the fields of panic records while capture is on, see
+// CapturePanics
+var panicFields atomic.Pointer[[]Field]
+
+// CapturePanics turns on panic capture: a goroutine that panics with
+// HandlePanic deferred logs a LevelFatal record to the default logger with
+// the panic value under "panic", fields, and the stack of the panic, then
+// panics again with the same value. The returned function restores the
+// previous capture settings.
+//
+//	defer zlog.CapturePanics(zlog.String("service", "api"))()
+//	defer zlog.HandlePanic()
+//
+// Go has no process-wide panic hook, so only goroutines that defer
+// HandlePanic are covered.
+func CapturePanics(fields ...Field) (undo func()) {
+	fields = slices.Clone(fields)
+	prev := panicFields.Swap(&fields)
+	return func() {
+		panicFields.Store(prev)
+	}
+}
+
+// HandlePanic logs the panic of the goroutine as set up by CapturePanics
+// and panics again. Defer it at the top of main or of a goroutine. The
+// record is logged whatever the default logger's level and stack trace
+// settings. Without CapturePanics, the panic is left alone.
+func HandlePanic() {
+	fields := panicFields.Load()
+	if fields == nil {
+		return
+	}
+	r := recover()
+	if r == nil {
+		return
+	}
+	logPanic(Default(), r, *fields)
+	panic(r)
+}
+
+// logPanic logs a recovered panic value. It must be called from the
+// deferred function that recovered it.
+func logPanic(l *StructuredLogger, r any, fields []Field) {
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(2, pcs[:])
+	stack := panicFrames(pcs[:n])
+
+	var attrs recordAttrs
+	if l.caller && len(stack) > 0 {
+		attrs.caller = callerForPC(stack[0])
+	}
+	attrs.stackBuf = GetBuffer(maxStackSize)
+	attrs.stack = appendStackPCs((*attrs.stackBuf)[:0], stack)
+
+	all := make([]Field, 0, 1+len(fields))
+	all = append(all, kvField("panic", r))
+	all = append(all, fields...)
+	l.writeFields(LevelFatal, clockNow(l.clock), "panic", all, &attrs)
+	attrs.release()
+}
+
+// panicFrames returns the frames below runtime.gopanic and the runtime
+// functions that raised the panic, starting at the function that
+// panicked. All of pcs is returned if the panic is not on it.
+func panicFrames(pcs []uintptr) []uintptr {
+	for i, pc := range pcs {
+		if pcFunction(pc) != "runtime.gopanic" {
+			continue
+		}
+		rest := pcs[i+1:]
+		for len(rest) > 1 && strings.HasPrefix(pcFunction(rest[0]), "runtime.") {
+			rest = rest[1:]
+		}
+		return rest
+	}
+	return pcs
+}
+
+// pcFunction returns the name of the function of a program counter from
+// runtime.Callers
+func pcFunction(pc uintptr) string {
+	if fn := runtime.FuncForPC(pc - 1); fn != nil {
+		return fn.Name()
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package zlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// panicLogger makes a JSON logger the default for the test
+func panicLogger(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&buf))
+	logger.SetLevel(LevelFatal)
+	logger.SetCallerEnabled(true)
+
+	prev := Default()
+	SetDefault(logger)
+	t.Cleanup(func() { SetDefault(prev) })
+	return &buf
+}
+
+func TestCapturePanics(t *testing.T) {
+	buf := panicLogger(t)
+
+	var want string
+	got := func() (r any) {
+		defer func() { r = recover() }()
+		defer CapturePanics(String("worker", "w1"))()
+		defer HandlePanic()
+		want = nextLine()
+		panic("boom")
+	}()
+	if got != "boom" {
+		t.Fatalf("recovered %v, want the original panic value", got)
+	}
+
+	out := buf.String()
+	for _, s := range []string{
+		`"level":"fatal"`,
+		`"msg":"panic","panic":"boom","worker":"w1"`,
+		`"caller":"` + want + `"`,
+		`"stack":"github.com/semihalev/zlog/v2.TestCapturePanics.func`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output missing %s: %s", s, out)
+		}
+	}
+}
+
+func TestCapturePanicsRuntimeError(t *testing.T) {
+	buf := panicLogger(t)
+
+	func() {
+		defer func() { recover() }()
+		defer CapturePanics()()
+		defer HandlePanic()
+		var m map[string]int
+		m["x"] = 1
+	}()
+
+	out := buf.String()
+	if !strings.Contains(out, `"panic":{"message":"assignment to entry in nil map"`) {
+		t.Errorf("panic error not recorded: %s", out)
+	}
+	if !strings.Contains(out, `"stack":"github.com/semihalev/zlog/v2.TestCapturePanicsRuntimeError.func`) {
+		t.Errorf("stack does not start at the panicking function: %s", out)
+	}
+}
+
+func TestCapturePanicsNoPanic(t *testing.T) {
+	buf := panicLogger(t)
+
+	func() {
+		defer CapturePanics()()
+		defer HandlePanic()
+	}()
+	if buf.Len() != 0 {
+		t.Errorf("logged without a panic: %s", buf.String())
+	}
+}
+
+func TestCapturePanicsUndo(t *testing.T) {
+	buf := panicLogger(t)
+
+	undo := CapturePanics(String("outer", "1"))
+	inner := CapturePanics(String("inner", "2"))
+	inner()
+
+	got := func() (r any) {
+		defer func() { r = recover() }()
+		defer HandlePanic()
+		panic("outer")
+	}()
+	if out := buf.String(); got != "outer" || !strings.Contains(out, `"panic":"outer","outer":"1"`) || strings.Contains(out, "inner") {
+		t.Errorf("after inner undo: recovered %v, logged %s", got, buf.String())
+	}
+
+	undo()
+	buf.Reset()
+	got = func() (r any) {
+		defer func() { r = recover() }()
+		defer HandlePanic()
+		panic("uncaptured")
+	}()
+	if got != "uncaptured" || buf.Len() != 0 {
+		t.Errorf("after undo: recovered %v, logged %s", got, buf.String())
+	}
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package zlog
+
+// raceEnabled reports whether the race detector is on. It adds allocations
+// of its own, so allocation checks are skipped under it.
+const raceEnabled = true
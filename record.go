@@ -0,0 +1,457 @@
+package zlog
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Binary record format (version 2)
+//
+// Every logger in this package emits the same record layout. All header
+// integers are little-endian; field values keep the big-endian encoding
+// used by encodeField.
+//
+//	offset  size  description
+//	0       4     magic "ZLOG" (MagicHeader)
+//	4       1     format version (Version)
+//	5       1     level
+//	6       2     flags (RecordFlags)
+//	8       4     total record length in bytes, header included
+//	12      8     sequence number (0 when the logger does not number records)
+//	20      8     wall-clock timestamp in Unix nanoseconds
+//	28      2     message length
+//	30      n     message bytes
+//	30+n    2     field count
+//	32+n    ...   fields: key length (1), key, type (1), value
+//
+// Bytes between the end of the last field and the record length are
+// attribute sections. Flag bits 8-15 each announce one section; sections
+// appear in ascending bit order, each a uint16 little-endian length
+// followed by its payload, so decoders can skip attributes they don't
+// understand. Bits 0-7 are plain flags without a section.
+//
+// Version 1 records (no length, three different header layouts) are still
+// accepted by DecodeRecord and ScanRecords.
+
+// RecordFlags describes optional properties of a record
+type RecordFlags uint16
+
+const (
+	// FlagTruncated marks a record whose message or fields were cut to fit
+	FlagTruncated RecordFlags = 1 << 0
+
+	// FlagMonotonic announces an 8-byte monotonic clock reading
+	FlagMonotonic RecordFlags = 1 << 8
+
+	// FlagCaller announces the call site: line (uint32), file length (1),
+	// file, function name
+	FlagCaller RecordFlags = 1 << 9
+
+	// FlagStack announces a stack trace as text
+	FlagStack RecordFlags = 1 << 10
+
+	attrFlagMask RecordFlags = 0xFF00
+)
+
+const (
+	// VersionV1 is the legacy record version without explicit length
+	VersionV1 byte = 1
+
+	recordHeaderSize = 28
+	maxMessageLen    = 65535
+	maxFieldCount    = 65535
+)
+
+// Record decoding errors
+var (
+	ErrShortRecord     = errors.New("zlog: record too short")
+	ErrInvalidMagic    = errors.New("zlog: invalid magic header")
+	ErrUnknownVersion  = errors.New("zlog: unknown record version")
+	ErrMalformedRecord = errors.New("zlog: malformed record")
+)
+
+// Record is a decoded view of a binary log record.
+// Message and field data alias the decoded buffer.
+type Record struct {
+	Version   byte
+	Level     Level
+	Flags     RecordFlags
+	Sequence  uint64
+	Time      int64 // Wall clock, Unix nanoseconds (monotonic for version 1)
+	Monotonic int64 // Monotonic clock reading, 0 if not recorded
+	Message   []byte
+	NumFields int
+
+	fields []byte // encoded fields
+	attrs  []byte // encoded attribute sections
+}
+
+// writeBinaryHeader writes the version 2 record header and returns its size.
+// The record length is filled in by finishRecord.
+//
+//go:inline
+func writeBinaryHeader(buf []byte, level Level, seq uint64, ts int64) int {
+	_ = buf[recordHeaderSize-1]
+	binary.LittleEndian.PutUint32(buf[0:], MagicHeader)
+	buf[4] = Version
+	buf[5] = byte(level)
+	binary.LittleEndian.PutUint16(buf[6:], 0)
+	binary.LittleEndian.PutUint32(buf[8:], 0)
+	binary.LittleEndian.PutUint64(buf[12:], seq)
+	binary.LittleEndian.PutUint64(buf[20:], uint64(ts))
+	return recordHeaderSize
+}
+
+// writeMessage writes the length-prefixed message at pos, truncating it to
+// leave room for the field count. It returns the new position and whether
+// the message was truncated.
+//
+//go:inline
+func writeMessage(buf []byte, pos int, msg string) (int, bool) {
+	msgLen := len(msg)
+	if msgLen > maxMessageLen {
+		msgLen = maxMessageLen
+	}
+	if room := len(buf) - pos - 4; msgLen > room {
+		msgLen = room
+	}
+	binary.LittleEndian.PutUint16(buf[pos:], uint16(msgLen))
+	pos += 2
+	copy(buf[pos:], msg[:msgLen])
+	return pos + msgLen, msgLen < len(msg)
+}
+
+// setFieldCount writes the field count at pos
+//
+//go:inline
+func setFieldCount(buf []byte, pos int, count int) {
+	binary.LittleEndian.PutUint16(buf[pos:], uint16(count))
+}
+
+// writeAttrHeader writes the length of an attribute section at pos and
+// returns the position of its payload
+//
+//go:inline
+func writeAttrHeader(buf []byte, pos int, n int) int {
+	binary.LittleEndian.PutUint16(buf[pos:], uint16(n))
+	return pos + 2
+}
+
+// finishRecord sets the flags and total length of the record in buf[:n]
+//
+//go:inline
+func finishRecord(buf []byte, n int, flags RecordFlags) {
+	binary.LittleEndian.PutUint16(buf[6:], uint16(flags))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(n))
+}
+
+// DecodeRecord decodes the record at the start of b into rec and returns the
+// number of bytes it occupies. Version 1 records carry no length, so they
+// must either fill b or be followed directly by another record.
+func DecodeRecord(b []byte, rec *Record) (int, error) {
+	if len(b) < 6 {
+		return 0, ErrShortRecord
+	}
+	if binary.LittleEndian.Uint32(b) != MagicHeader {
+		return 0, ErrInvalidMagic
+	}
+
+	switch b[4] {
+	case Version:
+		return decodeV2(b, rec)
+	case VersionV1:
+		layout, n := v1RecordEnd(b, true)
+		if n <= 0 {
+			return 0, ErrMalformedRecord
+		}
+		decodeV1(b[:n], layout, rec)
+		return n, nil
+	default:
+		return 0, ErrUnknownVersion
+	}
+}
+
+// decodeV2 decodes a version 2 record
+func decodeV2(b []byte, rec *Record) (int, error) {
+	if len(b) < recordHeaderSize+4 {
+		return 0, ErrShortRecord
+	}
+	n := int(binary.LittleEndian.Uint32(b[8:]))
+	if n < recordHeaderSize+4 {
+		return 0, ErrMalformedRecord
+	}
+	if n > len(b) {
+		return 0, ErrShortRecord
+	}
+	b = b[:n]
+
+	rec.Version = b[4]
+	rec.Level = Level(b[5])
+	rec.Flags = RecordFlags(binary.LittleEndian.Uint16(b[6:]))
+	rec.Sequence = binary.LittleEndian.Uint64(b[12:])
+	rec.Time = int64(binary.LittleEndian.Uint64(b[20:]))
+
+	pos := recordHeaderSize
+	msgLen := int(binary.LittleEndian.Uint16(b[pos:]))
+	pos += 2
+	if pos+msgLen+2 > n {
+		return 0, ErrMalformedRecord
+	}
+	rec.Message = b[pos : pos+msgLen]
+	pos += msgLen
+
+	rec.NumFields = int(binary.LittleEndian.Uint16(b[pos:]))
+	pos += 2
+	end := skipFields(b, pos, rec.NumFields)
+	if end < 0 {
+		return 0, ErrMalformedRecord
+	}
+	rec.fields = b[pos:end]
+	rec.attrs = b[end:]
+
+	rec.Monotonic = 0
+	if a := rec.attr(FlagMonotonic); len(a) == 8 {
+		rec.Monotonic = int64(binary.LittleEndian.Uint64(a))
+	}
+	return n, nil
+}
+
+// attr returns the payload of the attribute section announced by flag,
+// or nil if the record doesn't have it
+func (r *Record) attr(flag RecordFlags) []byte {
+	if r.Flags&flag == 0 || flag&attrFlagMask == 0 {
+		return nil
+	}
+	b := r.attrs
+	for bit := RecordFlags(1 << 8); bit != 0; bit <<= 1 {
+		if r.Flags&bit == 0 {
+			continue
+		}
+		if len(b) < 2 {
+			return nil
+		}
+		n := int(binary.LittleEndian.Uint16(b))
+		if 2+n > len(b) {
+			return nil
+		}
+		if bit == flag {
+			return b[2 : 2+n]
+		}
+		b = b[2+n:]
+	}
+	return nil
+}
+
+// Legacy version 1 layouts
+const (
+	v1Basic      = iota // Logger: 16-byte header, uint16 message length
+	v1Sequenced         // UltimateLogger: 22-byte header, 1-byte message length
+	v1Structured        // StructuredLogger: as v1Sequenced plus field count and fields
+)
+
+// v1RecordEnd determines the layout and length of the version 1 record at
+// the start of b. A candidate layout is accepted when it ends exactly at the
+// end of b (if atEOF) or right before another record's magic header. It
+// returns n == 0 when more data is needed and n < 0 when no layout fits.
+func v1RecordEnd(b []byte, atEOF bool) (layout int, n int) {
+	needMore := false
+	check := func(end int) bool {
+		switch {
+		case end < 0:
+			return false
+		case end == len(b):
+			if !atEOF {
+				needMore = true
+				return false
+			}
+			return true
+		case end+4 <= len(b):
+			return binary.LittleEndian.Uint32(b[end:]) == MagicHeader
+		default:
+			if !atEOF {
+				needMore = true
+			}
+			return false
+		}
+	}
+
+	if len(b) >= 16 {
+		if check(16 + int(binary.LittleEndian.Uint16(b[14:]))) {
+			return v1Basic, 16 + int(binary.LittleEndian.Uint16(b[14:]))
+		}
+	}
+	if len(b) >= 23 {
+		end := 23 + int(b[22])
+		if check(end) {
+			return v1Sequenced, end
+		}
+		if end < len(b) {
+			fend := skipFields(b, end+1, int(b[end]))
+			if check(fend) {
+				return v1Structured, fend
+			}
+		}
+	}
+	if needMore || (!atEOF && len(b) < 23) {
+		return 0, 0
+	}
+	return 0, -1
+}
+
+// decodeV1 decodes a complete version 1 record of the given layout
+func decodeV1(b []byte, layout int, rec *Record) {
+	rec.Version = VersionV1
+	rec.Level = Level(b[5])
+	rec.Flags = 0
+	rec.Monotonic = 0
+	rec.NumFields = 0
+	rec.fields = nil
+	rec.attrs = nil
+
+	switch layout {
+	case v1Basic:
+		rec.Sequence = 0
+		rec.Time = int64(binary.LittleEndian.Uint64(b[6:]))
+		rec.Message = b[16:]
+	default:
+		rec.Sequence = binary.LittleEndian.Uint64(b[6:])
+		rec.Time = int64(binary.LittleEndian.Uint64(b[14:]))
+		msgEnd := 23 + int(b[22])
+		rec.Message = b[23:msgEnd]
+		if layout == v1Structured {
+			rec.NumFields = int(b[msgEnd])
+			rec.fields = b[msgEnd+1:]
+		}
+	}
+}
+
+// skipFields returns the end offset of count encoded fields starting at pos,
+// or -1 if they don't fit in b
+func skipFields(b []byte, pos int, count int) int {
+	fr := fieldReader{b: b, pos: pos, n: count}
+	for fr.n > 0 {
+		if _, ok := fr.next(); !ok {
+			return -1
+		}
+	}
+	return fr.pos
+}
+
+// ScanRecords is a bufio.SplitFunc that splits a stream of binary records,
+// including version 1 records written before the format had a length.
+func ScanRecords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if len(data) == 0 {
+		return 0, nil, nil
+	}
+	if len(data) < 6 {
+		if atEOF {
+			return 0, nil, ErrShortRecord
+		}
+		return 0, nil, nil
+	}
+	if binary.LittleEndian.Uint32(data) != MagicHeader {
+		return 0, nil, ErrInvalidMagic
+	}
+
+	switch data[4] {
+	case Version:
+		if len(data) < 12 {
+			if atEOF {
+				return 0, nil, ErrShortRecord
+			}
+			return 0, nil, nil
+		}
+		n := int(binary.LittleEndian.Uint32(data[8:]))
+		if n < recordHeaderSize+4 {
+			return 0, nil, ErrMalformedRecord
+		}
+		if n > len(data) {
+			if atEOF {
+				return 0, nil, ErrShortRecord
+			}
+			return 0, nil, nil
+		}
+		return n, data[:n], nil
+	case VersionV1:
+		_, n := v1RecordEnd(data, atEOF)
+		if n < 0 {
+			return 0, nil, ErrMalformedRecord
+		}
+		if n == 0 {
+			if atEOF {
+				return 0, nil, ErrShortRecord
+			}
+			return 0, nil, nil
+		}
+		return n, data[:n], nil
+	default:
+		return 0, nil, ErrUnknownVersion
+	}
+}
+
+// rawField is an encoded field inside a record
+type rawField struct {
+	key []byte
+	typ FieldType
+	val []byte // encoded value, including any length prefix
+}
+
+// fieldReader iterates over the encoded fields of a record
+type fieldReader struct {
+	b   []byte
+	pos int
+	n   int // fields remaining
+}
+
+// fieldReader returns a reader over the record's fields
+func (r *Record) fieldReader() fieldReader {
+	return fieldReader{b: r.fields, n: r.NumFields}
+}
+
+// next decodes the next field. It returns false when there are no more
+// fields or the remaining data is malformed.
+func (fr *fieldReader) next() (rawField, bool) {
+	if fr.n <= 0 || fr.pos >= len(fr.b) {
+		return rawField{}, false
+	}
+	b := fr.b
+	pos := fr.pos
+
+	keyLen := int(b[pos])
+	pos++
+	if pos+keyLen+1 > len(b) {
+		return rawField{}, false
+	}
+	f := rawField{key: b[pos : pos+keyLen]}
+	pos += keyLen
+	f.typ = FieldType(b[pos])
+	pos++
+
+	size := encodedValueSize(b[pos:], f.typ)
+	if size < 0 || pos+size > len(b) {
+		return rawField{}, false
+	}
+	f.val = b[pos : pos+size]
+
+	fr.pos = pos + size
+	fr.n--
+	return f, true
+}
+
+// encodedValueSize returns the size of an encoded field value, or -1 if the
+// type is unknown or the length prefix is missing
+func encodedValueSize(b []byte, t FieldType) int {
+	switch t {
+	case FieldTypeInt, FieldTypeUint, FieldTypeBool, FieldTypeFloat64, FieldTypeTime, FieldTypeDuration:
+		return 8
+	case FieldTypeFloat32:
+		return 4
+	case FieldTypeString, FieldTypeBytes, FieldTypeError, FieldTypeObject, FieldTypeArray:
+		if len(b) < 2 {
+			return -1
+		}
+		return 2 + int(uint16(b[0])<<8|uint16(b[1]))
+	default:
+		return -1
+	}
+}
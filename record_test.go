@@ -0,0 +1,268 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := New()
+	logger.SetWriter(&buf)
+	logger.Info("basic")
+
+	structured := NewStructured()
+	structured.SetWriter(&buf)
+	structured.Warn("structured", String("key", "value"), Int("n", -7))
+
+	ultimate := NewUltimateLogger()
+	ultimate.SetWriter(&buf)
+	ultimate.Error("ultimate")
+
+	b := buf.Bytes()
+	want := []struct {
+		level  Level
+		msg    string
+		fields int
+	}{
+		{LevelInfo, "basic", 0},
+		{LevelWarn, "structured", 2},
+		{LevelError, "ultimate", 0},
+	}
+
+	var rec Record
+	for i, w := range want {
+		n, err := DecodeRecord(b, &rec)
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if rec.Version != Version {
+			t.Errorf("record %d: version = %d, want %d", i, rec.Version, Version)
+		}
+		if rec.Level != w.level || string(rec.Message) != w.msg || rec.NumFields != w.fields {
+			t.Errorf("record %d: got level=%v msg=%q fields=%d", i, rec.Level, rec.Message, rec.NumFields)
+		}
+		if int(binary.LittleEndian.Uint32(b[8:])) != n {
+			t.Errorf("record %d: length header does not match consumed bytes", i)
+		}
+		b = b[n:]
+	}
+	if len(b) != 0 {
+		t.Errorf("%d trailing bytes", len(b))
+	}
+}
+
+func TestRecordFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+	logger.Info("fields", String("s", "hello"), Bool("b", true), Float32("f", 1.5))
+
+	var rec Record
+	if _, err := DecodeRecord(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Sequence != 1 {
+		t.Errorf("sequence = %d, want 1", rec.Sequence)
+	}
+
+	keys := []string{"s", "b", "f"}
+	types := []FieldType{FieldTypeString, FieldTypeBool, FieldTypeFloat32}
+	fr := rec.fieldReader()
+	for i := range keys {
+		f, ok := fr.next()
+		if !ok {
+			t.Fatalf("field %d missing", i)
+		}
+		if string(f.key) != keys[i] || f.typ != types[i] {
+			t.Errorf("field %d: got %s/%d", i, f.key, f.typ)
+		}
+	}
+	if _, ok := fr.next(); ok {
+		t.Error("unexpected extra field")
+	}
+}
+
+func TestRecordTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+
+	fields := make([]Field, 50)
+	for i := range fields {
+		fields[i] = String("key", strings.Repeat("v", 2000))
+	}
+	logger.Info("big", fields...)
+
+	var rec Record
+	if _, err := DecodeRecord(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Flags&FlagTruncated != 0 && rec.NumFields == len(fields) {
+		t.Error("truncated record reports all fields")
+	}
+	fr := rec.fieldReader()
+	count := 0
+	for {
+		if _, ok := fr.next(); !ok {
+			break
+		}
+		count++
+	}
+	if count != rec.NumFields {
+		t.Errorf("decoded %d fields, header says %d", count, rec.NumFields)
+	}
+}
+
+// v1 record builders, matching the layouts written before version 2
+
+func buildV1Basic(level Level, ts uint64, msg string) []byte {
+	b := make([]byte, 16+len(msg))
+	binary.LittleEndian.PutUint32(b, MagicHeader)
+	b[4] = VersionV1
+	b[5] = byte(level)
+	binary.LittleEndian.PutUint64(b[6:], ts)
+	binary.LittleEndian.PutUint16(b[14:], uint16(len(msg)))
+	copy(b[16:], msg)
+	return b
+}
+
+func buildV1Sequenced(level Level, seq, ts uint64, msg string) []byte {
+	b := make([]byte, 23+len(msg))
+	binary.LittleEndian.PutUint32(b, MagicHeader)
+	b[4] = VersionV1
+	b[5] = byte(level)
+	binary.LittleEndian.PutUint64(b[6:], seq)
+	binary.LittleEndian.PutUint64(b[14:], ts)
+	b[22] = byte(len(msg))
+	copy(b[23:], msg)
+	return b
+}
+
+func buildV1Structured(level Level, seq, ts uint64, msg string, fields ...Field) []byte {
+	b := buildV1Sequenced(level, seq, ts, msg)
+	b = append(b, byte(len(fields)))
+	var tmp [256]byte
+	for i := range fields {
+		n := encodeField(tmp[:], &fields[i])
+		b = append(b, tmp[:n]...)
+	}
+	return b
+}
+
+func TestDecodeRecordV1(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		seq    uint64
+		msg    string
+		fields int
+	}{
+		{"Basic", buildV1Basic(LevelInfo, 100, "hello"), 0, "hello", 0},
+		{"Sequenced", buildV1Sequenced(LevelWarn, 7, 100, "ultimate"), 7, "ultimate", 0},
+		{"Structured", buildV1Structured(LevelError, 9, 100, "structured", String("k", "v"), Int("n", 3)), 9, "structured", 2},
+		{"StructuredNoFields", buildV1Structured(LevelDebug, 3, 100, "empty"), 3, "empty", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rec Record
+			n, err := DecodeRecord(tt.data, &rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(tt.data) {
+				t.Errorf("consumed %d bytes, want %d", n, len(tt.data))
+			}
+			if rec.Version != VersionV1 || rec.Time != 100 || rec.Sequence != tt.seq {
+				t.Errorf("got version=%d time=%d seq=%d", rec.Version, rec.Time, rec.Sequence)
+			}
+			if string(rec.Message) != tt.msg || rec.NumFields != tt.fields {
+				t.Errorf("got msg=%q fields=%d", rec.Message, rec.NumFields)
+			}
+		})
+	}
+}
+
+func TestScanRecords(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(buildV1Basic(LevelInfo, 1, "one"))
+	stream.Write(buildV1Structured(LevelInfo, 2, 2, "two", String("k", "v")))
+	stream.Write(buildV1Sequenced(LevelInfo, 3, 3, "three"))
+
+	logger := NewStructured()
+	logger.SetWriter(&stream)
+	logger.Info("four", Int("n", 4))
+
+	// A tiny reader buffer forces the splitter to ask for more data
+	sc := bufio.NewScanner(bufio.NewReaderSize(&stream, 16))
+	sc.Split(ScanRecords)
+
+	var msgs []string
+	var rec Record
+	for sc.Scan() {
+		if _, err := DecodeRecord(sc.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, string(rec.Message))
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(msgs, ","); got != "one,two,three,four" {
+		t.Errorf("scanned %q", got)
+	}
+}
+
+func TestDecodeRecordErrors(t *testing.T) {
+	var rec Record
+	if _, err := DecodeRecord([]byte{1, 2}, &rec); err != ErrShortRecord {
+		t.Errorf("short: got %v", err)
+	}
+	if _, err := DecodeRecord(make([]byte, 40), &rec); err != ErrInvalidMagic {
+		t.Errorf("magic: got %v", err)
+	}
+
+	b := buildV1Basic(LevelInfo, 0, "x")
+	b[4] = 99
+	if _, err := DecodeRecord(b, &rec); err != ErrUnknownVersion {
+		t.Errorf("version: got %v", err)
+	}
+
+	var buf bytes.Buffer
+	logger := New()
+	logger.SetWriter(&buf)
+	logger.Info("cut short")
+	if _, err := DecodeRecord(buf.Bytes()[:buf.Len()-1], &rec); err == nil {
+		t.Error("expected error for truncated v2 record")
+	}
+}
+
+func TestTerminalWriterMultipleRecords(t *testing.T) {
+	var raw bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&raw)
+	logger.Info("first", Int("n", 1))
+	logger.Info("second", Int("n", 2))
+	raw.Write(buildV1Basic(LevelWarn, 0, "legacy"))
+
+	var out bytes.Buffer
+	tw := NewTerminalWriter(&out)
+	if _, err := tw.Write(raw.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines: %q", len(lines), out.String())
+	}
+	if !strings.Contains(lines[1], "second") || !strings.Contains(lines[1], "n=2") {
+		t.Errorf("unexpected line %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "legacy") {
+		t.Errorf("unexpected line %q", lines[2])
+	}
+}
@@ -2,6 +2,7 @@ package zlog
 
 import (
 	"io"
+	"os"
 	"sync/atomic"
 	"unsafe"
 )
@@ -31,51 +32,75 @@ func SetDefault(logger *StructuredLogger) {
 	atomic.StorePointer(&defaultLogger, unsafe.Pointer(logger))
 }
 
-// Global logging functions that use the default logger
+// Global logging functions that use the default logger. They accept
+// key-value pairs, Fields, or both interleaved:
+//
+//	zlog.Info("saved", zlog.Int("id", id), "table", "users")
+//
+// They call the core logging functions directly, like the logger methods,
+// so caller capture skips the same number of frames.
 
 // Debug logs a debug message using the default logger
 func Debug(msg string, keysAndValues ...any) {
+	l := Default()
+	if !l.shouldLog(LevelDebug) {
+		return
+	}
 	if len(keysAndValues) == 0 {
-		Default().Debug(msg)
+		l.logFields(LevelDebug, msg, nil)
 	} else {
-		Default().DebugKV(msg, keysAndValues...)
+		l.logKV(LevelDebug, msg, keysAndValues...)
 	}
 }
 
 // Info logs an info message using the default logger
 func Info(msg string, keysAndValues ...any) {
+	l := Default()
+	if !l.shouldLog(LevelInfo) {
+		return
+	}
 	if len(keysAndValues) == 0 {
-		Default().Info(msg)
+		l.logFields(LevelInfo, msg, nil)
 	} else {
-		Default().InfoKV(msg, keysAndValues...)
+		l.logKV(LevelInfo, msg, keysAndValues...)
 	}
 }
 
 // Warn logs a warning message using the default logger
 func Warn(msg string, keysAndValues ...any) {
+	l := Default()
+	if !l.shouldLog(LevelWarn) {
+		return
+	}
 	if len(keysAndValues) == 0 {
-		Default().Warn(msg)
+		l.logFields(LevelWarn, msg, nil)
 	} else {
-		Default().WarnKV(msg, keysAndValues...)
+		l.logKV(LevelWarn, msg, keysAndValues...)
 	}
 }
 
 // Error logs an error message using the default logger
 func Error(msg string, keysAndValues ...any) {
+	l := Default()
+	if !l.shouldLog(LevelError) {
+		return
+	}
 	if len(keysAndValues) == 0 {
-		Default().Error(msg)
+		l.logFields(LevelError, msg, nil)
 	} else {
-		Default().ErrorKV(msg, keysAndValues...)
+		l.logKV(LevelError, msg, keysAndValues...)
 	}
 }
 
 // Fatal logs a fatal message using the default logger and exits
 func Fatal(msg string, keysAndValues ...any) {
+	l := Default()
 	if len(keysAndValues) == 0 {
-		Default().Fatal(msg)
+		l.logFields(LevelFatal, msg, nil)
 	} else {
-		Default().FatalKV(msg, keysAndValues...)
+		l.logKV(LevelFatal, msg, keysAndValues...)
 	}
+	os.Exit(1)
 }
 
 // SetLevel sets the minimum log level for the default logger
@@ -87,3 +112,8 @@ func SetLevel(level Level) {
 func SetWriter(w io.Writer) {
 	Default().SetWriter(w)
 }
+
+// SetCallerEnabled enables call site capture for the default logger
+func SetCallerEnabled(enabled bool) {
+	Default().SetCallerEnabled(enabled)
+}
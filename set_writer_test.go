@@ -0,0 +1,118 @@
+package zlog
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSwapWriter(t *testing.T) {
+	var a, b bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&a)
+
+	logger.Info("first")
+	if prev := logger.SwapWriter(&b); prev != &a {
+		t.Errorf("SwapWriter returned %v", prev)
+	}
+	logger.Info("second")
+
+	if _, msg := decodeStdLog(t, a.Bytes()); msg != "first" {
+		t.Errorf("previous writer got %q", msg)
+	}
+	if _, msg := decodeStdLog(t, b.Bytes()); msg != "second" {
+		t.Errorf("new writer got %q", msg)
+	}
+
+	ultimate := NewUltimateLogger()
+	if prev := ultimate.SwapWriter(&b); prev != io.Discard {
+		t.Errorf("UltimateLogger.SwapWriter returned %v", prev)
+	}
+}
+
+// blockingWriter blocks every write until release is closed
+type blockingWriter struct {
+	entered  chan struct{}
+	release  chan struct{}
+	finished atomic.Bool
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	close(w.entered)
+	<-w.release
+	w.finished.Store(true)
+	return len(p), nil
+}
+
+func TestSwapWriterWaitsForWrites(t *testing.T) {
+	old := &blockingWriter{entered: make(chan struct{}), release: make(chan struct{})}
+	logger := NewStructured()
+	logger.SetWriter(old)
+
+	go logger.Info("in flight")
+	<-old.entered
+
+	swapped := make(chan Writer)
+	go func() { swapped <- logger.SwapWriter(io.Discard) }()
+	select {
+	case <-swapped:
+		t.Fatal("SwapWriter returned while a write was running on the previous writer")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(old.release)
+	if prev := <-swapped; prev != old || !old.finished.Load() {
+		t.Errorf("SwapWriter returned %v before the write finished", prev)
+	}
+}
+
+// TestSetWriterConcurrent swaps writers while other goroutines log; run it
+// with -race
+func TestSetWriterConcurrent(t *testing.T) {
+	const goroutines, records = 4, 1000
+
+	logger := NewStructured()
+	ultimate := NewUltimateLogger()
+	var count atomic.Int32
+	writers := []*countingWriter{{&count}, {&count}, {&count}}
+	logger.SetWriter(writers[0])
+	ultimate.SetWriter(writers[0])
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	swapped := make(chan struct{})
+	go func() {
+		defer close(swapped)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			logger.SetWriter(writers[i%len(writers)])
+			ultimate.SwapWriter(writers[(i+1)%len(writers)])
+		}
+	}()
+
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < records; i++ {
+				logger.Info("structured", Int("i", i))
+				logger.Logger.Info("plain")
+				ultimate.Info("ultimate")
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-swapped
+
+	if got := count.Load(); got != 3*goroutines*records {
+		t.Errorf("got %d records, want %d", got, 3*goroutines*records)
+	}
+}
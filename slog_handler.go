@@ -0,0 +1,192 @@
+package zlog
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+)
+
+// SlogHandler is a log/slog Handler that logs through a StructuredLogger.
+// slog kinds map to the matching field types, groups become nested
+// objects, and slog levels map to the nearest level at or below them.
+type SlogHandler struct {
+	logger *StructuredLogger // Carries the attributes added outside groups
+	groups []slogGroup       // Open groups, outermost first
+}
+
+// slogGroup is a group opened with WithGroup and the attributes added to
+// it since
+type slogGroup struct {
+	name  string
+	attrs []slog.Attr
+}
+
+// NewSlogHandler creates a handler that logs through logger
+func NewSlogHandler(logger *StructuredLogger) *SlogHandler {
+	return &SlogHandler{logger: logger}
+}
+
+// Enabled reports whether the logger's level lets level through
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.shouldLog(slogLevel(level))
+}
+
+// Handle logs the record. A zero record time is logged without a time.
+func (h *SlogHandler) Handle(_ context.Context, r slog.Record) error {
+	level := slogLevel(r.Level)
+
+	var stackFields [16]Field
+	fields := stackFields[:0]
+	add := func(f Field) { fields = append(fields, f) }
+	r.Attrs(func(a slog.Attr) bool {
+		forSlogAttr(a, add)
+		return true
+	})
+
+	// Wrap the record's fields in the open groups, innermost first.
+	// Groups left empty are dropped.
+	for i := len(h.groups) - 1; i >= 0; i-- {
+		g := &h.groups[i]
+		var content []Field
+		for _, a := range g.attrs {
+			forSlogAttr(a, func(f Field) { content = append(content, f) })
+		}
+		content = append(content, fields...)
+		if len(content) == 0 {
+			continue
+		}
+		fields = append(stackFields[:0], Object(g.name, slogFields(content)))
+	}
+
+	var ts int64
+	if !r.Time.IsZero() {
+		ts = r.Time.UnixNano()
+	}
+
+	attrs := h.logger.attrsAt(level, r.PC)
+	h.logger.writeFields(level, ts, r.Message, fields, &attrs)
+	attrs.release()
+	return nil
+}
+
+// WithAttrs returns a handler that adds attrs to every record. Outside a
+// group they are encoded once, as with StructuredLogger.With.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	if len(h.groups) == 0 {
+		var fields []Field
+		for _, a := range attrs {
+			forSlogAttr(a, func(f Field) { fields = append(fields, f) })
+		}
+		h2.logger = h.logger.With(fields...)
+		return &h2
+	}
+
+	h2.groups = slices.Clone(h.groups)
+	last := &h2.groups[len(h2.groups)-1]
+	last.attrs = append(slices.Clip(last.attrs), attrs...)
+	return &h2
+}
+
+// WithGroup returns a handler that nests later attributes under name
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(slices.Clip(h.groups), slogGroup{name: name})
+	return &h2
+}
+
+// slogLevel maps a slog level to the nearest level at or below it.
+// Levels above error stay at LevelError, since LevelFatal exits.
+func slogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+// forSlogAttr calls add with the field for an attribute. Empty attributes
+// and empty groups are dropped and groups with an empty key are inlined.
+func forSlogAttr(a slog.Attr, add func(Field)) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	v := a.Value
+	switch v.Kind() {
+	case slog.KindString:
+		add(String(a.Key, v.String()))
+	case slog.KindInt64:
+		add(Int64(a.Key, v.Int64()))
+	case slog.KindUint64:
+		add(Uint64(a.Key, v.Uint64()))
+	case slog.KindFloat64:
+		add(Float64(a.Key, v.Float64()))
+	case slog.KindBool:
+		add(Bool(a.Key, v.Bool()))
+	case slog.KindDuration:
+		add(Duration(a.Key, v.Duration()))
+	case slog.KindTime:
+		add(Time(a.Key, v.Time()))
+	case slog.KindGroup:
+		if a.Key == "" {
+			for _, ga := range v.Group() {
+				forSlogAttr(ga, add)
+			}
+		} else if slogHasFields(v.Group()) {
+			add(Object(a.Key, slogAttrs(v.Group())))
+		}
+	default:
+		add(kvField(a.Key, v.Any()))
+	}
+}
+
+// slogHasFields reports whether any of attrs produces a field
+func slogHasFields(attrs []slog.Attr) bool {
+	for _, a := range attrs {
+		v := a.Value.Resolve()
+		if v.Kind() != slog.KindGroup {
+			if a.Key != "" || !v.Equal(slog.Value{}) {
+				return true
+			}
+		} else if slogHasFields(v.Group()) {
+			return true
+		}
+	}
+	return false
+}
+
+// slogAttrs is the content of a slog group
+type slogAttrs []slog.Attr
+
+// MarshalLogObject adds the group's fields
+func (as slogAttrs) MarshalLogObject(enc ObjectEncoder) error {
+	add := func(f Field) { enc.AddField(f) }
+	for _, a := range as {
+		forSlogAttr(a, add)
+	}
+	return nil
+}
+
+// slogFields is the content of a group opened with WithGroup
+type slogFields []Field
+
+// MarshalLogObject adds the group's fields
+func (fs slogFields) MarshalLogObject(enc ObjectEncoder) error {
+	for _, f := range fs {
+		enc.AddField(f)
+	}
+	return nil
+}
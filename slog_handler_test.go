@@ -0,0 +1,148 @@
+package zlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/slogtest"
+	"time"
+)
+
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetLevel(LevelDebug)
+	logger.SetWriter(NewJSONWriter(&buf))
+
+	err := slogtest.TestHandler(NewSlogHandler(logger), func() []map[string]any {
+		var ms []map[string]any
+		for _, line := range bytes.Split(buf.Bytes(), []byte{'\n'}) {
+			if len(line) == 0 {
+				continue
+			}
+			var m map[string]any
+			if err := json.Unmarshal(line, &m); err != nil {
+				t.Fatalf("%v: %s", err, line)
+			}
+			ms = append(ms, m)
+		}
+		return ms
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSlogHandlerLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+	logger.SetLevel(LevelWarn)
+	h := NewSlogHandler(logger)
+
+	ctx := context.Background()
+	if h.Enabled(ctx, slog.LevelInfo) || !h.Enabled(ctx, slog.LevelWarn) || !h.Enabled(ctx, slog.LevelError+4) {
+		t.Error("Enabled does not follow the logger level")
+	}
+	logger.SetLevel(LevelDebug)
+	if !h.Enabled(ctx, slog.LevelDebug) {
+		t.Error("Enabled does not see level changes")
+	}
+
+	for _, tt := range []struct {
+		slog slog.Level
+		want Level
+	}{
+		{slog.LevelDebug - 4, LevelDebug},
+		{slog.LevelDebug, LevelDebug},
+		{slog.LevelInfo + 1, LevelInfo},
+		{slog.LevelWarn, LevelWarn},
+		{slog.LevelError, LevelError},
+		{slog.LevelError + 8, LevelError},
+	} {
+		if got := slogLevel(tt.slog); got != tt.want {
+			t.Errorf("slogLevel(%v) = %v, want %v", tt.slog, got, tt.want)
+		}
+	}
+}
+
+func TestSlogHandlerFieldTypes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+
+	slog.New(NewSlogHandler(logger)).Info("typed",
+		"s", "x", "i", -1, "u", uint64(2), "f", 1.5, "b", true,
+		"d", time.Second, "t", time.Unix(1, 0), "g", slog.GroupValue(slog.Int("n", 1)))
+
+	var rec Record
+	if _, err := DecodeRecord(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	var types []FieldType
+	fr := rec.fieldReader()
+	for {
+		f, ok := fr.next()
+		if !ok {
+			break
+		}
+		types = append(types, f.typ)
+	}
+	want := []FieldType{FieldTypeString, FieldTypeInt, FieldTypeUint, FieldTypeFloat64, FieldTypeBool,
+		FieldTypeDuration, FieldTypeTime, FieldTypeObject}
+	if len(types) != len(want) {
+		t.Fatalf("got types %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Errorf("field %d has type %v, want %v", i, types[i], want[i])
+		}
+	}
+}
+
+func TestSlogHandlerCaller(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewLogfmtWriter(&buf))
+	logger.SetCallerEnabled(true)
+	sl := slog.New(NewSlogHandler(logger))
+
+	want := nextLine()
+	sl.Info("hello")
+	if !strings.Contains(buf.String(), " caller="+want) {
+		t.Errorf("%q lacks caller %s", buf.String(), want)
+	}
+}
+
+func TestSlogHandlerZeroAlloc(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful under the race detector")
+	}
+	logger := NewStructured()
+	logger.SetWriter(io.Discard)
+	logger.SetFormat(FormatJSON)
+	sl := slog.New(NewSlogHandler(logger)).With("service", "api")
+
+	allocs := testing.AllocsPerRun(100, func() {
+		sl.Info("request", "status", 200, "path", "/users")
+	})
+	if allocs != 0 {
+		t.Errorf("%.1f allocs per log", allocs)
+	}
+}
+
+func BenchmarkSlogHandler(b *testing.B) {
+	logger := NewStructured()
+	logger.SetWriter(io.Discard)
+	sl := slog.New(NewSlogHandler(logger))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sl.Info("request", "status", 200, "path", "/users")
+	}
+}
@@ -0,0 +1,93 @@
+package zlog
+
+import (
+	"runtime"
+	"strconv"
+)
+
+// maxStackSize bounds the stack trace stored in a record. Frames that do
+// not fit are dropped.
+const maxStackSize = 8 << 10
+
+// maxStackDepth bounds the number of frames walked
+const maxStackDepth = 64
+
+// stackKey is the logfmt key of the stack trace
+var stackKey = []byte("stack")
+
+// SetStackTraceEnabled adds a stack trace of the logging goroutine to
+// records at or above the stack trace level (LevelError by default). Set it
+// before the logger is shared between goroutines.
+func (l *Logger) SetStackTraceEnabled(enabled bool) {
+	l.stack = enabled
+}
+
+// SetStackTraceLevel sets the lowest level that carries a stack trace when
+// stack traces are enabled. Set it before the logger is shared between
+// goroutines.
+func (l *Logger) SetStackTraceLevel(level Level) {
+	l.stackLevel = level
+}
+
+// appendStack appends the stack skip frames above the function calling
+// appendStack, formatted like a panic trace: the function name, then the
+// tab-indented file:line, one frame after another
+func appendStack(buf []byte, skip int) []byte {
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(skip+2, pcs[:])
+	return appendStackPCs(buf, pcs[:n])
+}
+
+// appendStackFrom appends the stack of the calling goroutine starting at
+// the frame of pc, a program counter from runtime.Callers. The whole stack
+// is used if pc is not on it.
+func appendStackFrom(buf []byte, pc uintptr) []byte {
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(2, pcs[:])
+	stack := pcs[:n]
+	for i, p := range stack {
+		if p == pc {
+			stack = stack[i:]
+			break
+		}
+	}
+	return appendStackPCs(buf, stack)
+}
+
+// appendStackPCs appends the frames of pcs
+func appendStackPCs(buf []byte, pcs []uintptr) []byte {
+	frames := runtime.CallersFrames(pcs)
+
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.goexit" {
+			break
+		}
+
+		size := len(frame.Function) + len(frame.File) + 14
+		if len(buf)+size > maxStackSize {
+			break
+		}
+		buf = append(buf, frame.Function...)
+		buf = append(buf, '\n', '\t')
+		buf = append(buf, frame.File...)
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, int64(frame.Line), 10)
+		buf = append(buf, '\n')
+
+		if !more {
+			break
+		}
+	}
+
+	// Drop the final newline
+	if len(buf) > 0 {
+		buf = buf[:len(buf)-1]
+	}
+	return buf
+}
+
+// Stack returns the stack trace recorded with FlagStack
+func (r *Record) Stack() []byte {
+	return r.attr(FlagStack)
+}
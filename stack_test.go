@@ -0,0 +1,163 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStackTrace(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+	logger.SetStackTraceEnabled(true)
+
+	logger.Warn("below threshold")
+	logger.Error("failed", Int("code", 7))
+	logger.ErrorKV("failed kv", "code", 7)
+	logger.Logger.Error("failed plain")
+
+	var rec Record
+	b := buf.Bytes()
+	n, err := DecodeRecord(b, &rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Stack() != nil || rec.Flags&FlagStack != 0 {
+		t.Error("warn record carries a stack trace")
+	}
+	b = b[n:]
+
+	for len(b) > 0 {
+		n, err := DecodeRecord(b, &rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = b[n:]
+
+		stack := string(rec.Stack())
+		if rec.Flags&FlagStack == 0 {
+			t.Fatalf("%s: no stack flag", rec.Message)
+		}
+		// The trace starts at the test function, not inside the logger
+		if !strings.HasPrefix(stack, "github.com/semihalev/zlog/v2.TestStackTrace\n\t") {
+			t.Errorf("%s: stack starts with %q", rec.Message, stack[:min(len(stack), 80)])
+		}
+		if !strings.Contains(stack, "stack_test.go:") {
+			t.Errorf("%s: stack lacks the call site:\n%s", rec.Message, stack)
+		}
+	}
+}
+
+func TestStackTraceLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+	logger.SetStackTraceEnabled(true)
+	logger.SetStackTraceLevel(LevelWarn)
+
+	logger.Warn("warned")
+
+	var rec Record
+	if _, err := DecodeRecord(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Stack() == nil {
+		t.Error("warn record lacks a stack trace")
+	}
+}
+
+func TestStackTraceBounded(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+	logger.SetStackTraceEnabled(true)
+
+	var recurse func(int)
+	recurse = func(depth int) {
+		if depth == 0 {
+			logger.Error("deep")
+			return
+		}
+		recurse(depth - 1)
+	}
+	recurse(200)
+
+	var rec Record
+	if _, err := DecodeRecord(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	stack := rec.Stack()
+	if len(stack) == 0 || len(stack) > maxStackSize {
+		t.Errorf("stack size %d out of bounds", len(stack))
+	}
+	if frames := strings.Count(string(stack), "\n\t"); frames > maxStackDepth {
+		t.Errorf("%d frames exceed the depth limit", frames)
+	}
+}
+
+func TestStackTraceWriters(t *testing.T) {
+	t.Run("Terminal", func(t *testing.T) {
+		var out bytes.Buffer
+		logger := NewStructured()
+		logger.SetWriter(NewTerminalWriter(&out))
+		logger.SetStackTraceEnabled(true)
+		logger.Error("boom")
+
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		if len(lines) < 3 {
+			t.Fatalf("expected a multi-line block, got %q", out.String())
+		}
+		if lines[1] != "    github.com/semihalev/zlog/v2.TestStackTraceWriters.func1" ||
+			!strings.HasPrefix(lines[2], "    \t") {
+			t.Errorf("unexpected block:\n%s", out.String())
+		}
+	})
+
+	for _, tt := range []struct {
+		name   string
+		format LogFormat
+		writer func(io.Writer) io.Writer
+	}{
+		{"JSON", FormatJSON, func(w io.Writer) io.Writer { return NewJSONWriter(w) }},
+		{"Text", FormatText, func(w io.Writer) io.Writer { return NewLogfmtWriter(w) }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var decoded, direct bytes.Buffer
+			for _, l := range []struct {
+				format LogFormat
+				out    *bytes.Buffer
+			}{{FormatBinary, &decoded}, {tt.format, &direct}} {
+				logger := NewStructured()
+				logger.SetStackTraceEnabled(true)
+				logger.SetFormat(l.format)
+				if l.format == FormatBinary {
+					logger.SetWriter(tt.writer(l.out))
+				} else {
+					logger.SetWriter(l.out)
+				}
+				logger.Error("boom")
+			}
+
+			for _, out := range []string{decoded.String(), direct.String()} {
+				if strings.Count(out, "\n") != 1 {
+					t.Fatalf("stack is not a single escaped field: %q", out)
+				}
+				if tt.format == FormatJSON {
+					var obj map[string]any
+					if err := json.Unmarshal([]byte(out), &obj); err != nil {
+						t.Fatal(err)
+					}
+					if s, _ := obj["stack"].(string); !strings.Contains(s, "\n\t") {
+						t.Errorf("stack = %q", s)
+					}
+				} else if !strings.Contains(out, ` stack="github.com/semihalev/zlog/v2.`) ||
+					!strings.Contains(out, `\n\t`) {
+					t.Errorf("unexpected logfmt output %q", out)
+				}
+			}
+		})
+	}
+}
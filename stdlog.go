@@ -0,0 +1,199 @@
+package zlog
+
+import (
+	"bytes"
+	"log"
+	"runtime"
+	"strings"
+)
+
+// stdLogTagMax bounds the length of a level tag such as [WARNING]
+const stdLogTagMax = 8
+
+// StdLogWriter is an io.Writer for a standard library *log.Logger. Each
+// write is one line of the log package; its prefix, date, time and file
+// header are stripped and the message is logged as a record.
+type StdLogWriter struct {
+	logger   *StructuredLogger // Nil for the default logger
+	level    Level
+	prefix   string
+	flags    int
+	noLevels bool
+}
+
+// NewStdLog returns a *log.Logger that logs every line through logger at
+// level, or at the level named by a leading tag such as [WARN]. Use it
+// for APIs that only accept a *log.Logger, like http.Server.ErrorLog.
+func NewStdLog(logger *StructuredLogger, level Level) *log.Logger {
+	return log.New(NewStdLogWriter(logger, level), "", 0)
+}
+
+// NewStdLogWriter creates a writer that logs lines through logger at
+// level. Level tags are detected by default.
+func NewStdLogWriter(logger *StructuredLogger, level Level) *StdLogWriter {
+	return &StdLogWriter{logger: logger, level: level}
+}
+
+// SetPrefix sets the prefix of the *log.Logger writing to w, so it can be
+// stripped. Set it before the writer is in use.
+func (w *StdLogWriter) SetPrefix(prefix string) {
+	w.prefix = prefix
+}
+
+// SetFlags sets the flags of the *log.Logger writing to w, so its header
+// can be stripped. Set it before the writer is in use.
+func (w *StdLogWriter) SetFlags(flags int) {
+	w.flags = flags
+}
+
+// SetLevelDetectionEnabled controls whether a leading [DEBUG], [INFO],
+// [WARN], [ERROR] or [FATAL] tag picks the level of a line. Tags are
+// matched case-insensitively and removed from the message. Set it before
+// the writer is in use.
+func (w *StdLogWriter) SetLevelDetectionEnabled(enabled bool) {
+	w.noLevels = !enabled
+}
+
+// Write logs one line written by a *log.Logger. It never fails.
+func (w *StdLogWriter) Write(p []byte) (int, error) {
+	msg := w.stripHeader(p)
+
+	level := w.level
+	if !w.noLevels {
+		if tagLevel, n := stdLogLevel(msg); n > 0 {
+			level = tagLevel
+			msg = bytes.TrimLeft(msg[n:], " ")
+		}
+	}
+
+	l := w.logger
+	if l == nil {
+		l = Default()
+	}
+	if !l.shouldLog(level) {
+		return len(p), nil
+	}
+
+	var attrs recordAttrs
+	if l.caller || l.stack {
+		attrs = l.attrsAt(level, stdLogCaller())
+	}
+	l.writeFields(level, clockNow(l.clock), BytesToString(msg), nil, &attrs)
+	attrs.release()
+	return len(p), nil
+}
+
+// RedirectStdLog sends the output of the log package's standard logger to
+// the default logger at LevelInfo, or the level of a leading tag such as
+// [WARN]. The standard logger's date and time are dropped, since records
+// carry their own. The returned function restores its previous output,
+// flags and prefix.
+func RedirectStdLog() (undo func()) {
+	out, flags, prefix := log.Writer(), log.Flags(), log.Prefix()
+
+	w := &StdLogWriter{level: LevelInfo, prefix: prefix, flags: flags &^ (log.Ldate | log.Ltime | log.Lmicroseconds)}
+	log.SetFlags(w.flags)
+	log.SetOutput(w)
+
+	return func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+	}
+}
+
+// stripHeader removes the trailing newline and the header the log package
+// adds for w's prefix and flags
+func (w *StdLogWriter) stripHeader(p []byte) []byte {
+	msg := bytes.TrimSuffix(p, []byte{'\n'})
+
+	if w.flags&log.Lmsgprefix == 0 {
+		msg = bytes.TrimPrefix(msg, []byte(w.prefix))
+	}
+	if w.flags&log.Ldate != 0 {
+		msg = skipBytes(msg, len("2006/01/02 "))
+	}
+	if w.flags&(log.Ltime|log.Lmicroseconds) != 0 {
+		n := len("15:04:05 ")
+		if w.flags&log.Lmicroseconds != 0 {
+			n += len(".000000")
+		}
+		msg = skipBytes(msg, n)
+	}
+	if w.flags&(log.Lshortfile|log.Llongfile) != 0 {
+		if i := bytes.Index(msg, []byte(": ")); i >= 0 {
+			msg = msg[i+2:]
+		}
+	}
+	if w.flags&log.Lmsgprefix != 0 {
+		msg = bytes.TrimPrefix(msg, []byte(w.prefix))
+	}
+	return msg
+}
+
+// skipBytes drops up to n bytes from the start of b
+//
+//go:inline
+func skipBytes(b []byte, n int) []byte {
+	if n > len(b) {
+		n = len(b)
+	}
+	return b[n:]
+}
+
+// stdLogLevel parses a level tag at the start of msg and returns its level
+// and length, or a length of 0 if there is none
+func stdLogLevel(msg []byte) (Level, int) {
+	if len(msg) < 3 || msg[0] != '[' {
+		return 0, 0
+	}
+	end := bytes.IndexByte(msg[1:min(len(msg), stdLogTagMax+2)], ']')
+	if end <= 0 {
+		return 0, 0
+	}
+
+	var tag [stdLogTagMax]byte
+	for i, c := range msg[1 : 1+end] {
+		if 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		tag[i] = c
+	}
+
+	var level Level
+	switch string(tag[:end]) {
+	case "DEBUG", "TRACE":
+		level = LevelDebug
+	case "INFO", "NOTICE":
+		level = LevelInfo
+	case "WARN", "WARNING":
+		level = LevelWarn
+	case "ERROR", "ERR":
+		level = LevelError
+	case "FATAL":
+		level = LevelFatal
+	default:
+		return 0, 0
+	}
+	return level, end + 2
+}
+
+// stdLogCaller returns the program counter of the first frame outside the
+// log package, the code that called log.Printf or similar
+func stdLogCaller() uintptr {
+	var pcs [16]uintptr
+	// Skip runtime.Callers, stdLogCaller and StdLogWriter.Write
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "log.") {
+			// Frame.PC is the call instruction; runtime.Callers reports
+			// the return address after it
+			return frame.PC + 1
+		}
+		if !more {
+			return 0
+		}
+	}
+}
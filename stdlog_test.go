@@ -0,0 +1,164 @@
+package zlog
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func decodeStdLog(t *testing.T, b []byte) (Level, string) {
+	t.Helper()
+	var rec Record
+	if _, err := DecodeRecord(b, &rec); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Level, string(rec.Message)
+}
+
+func TestStdLogHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		flags  int
+	}{
+		{"Plain", "", 0},
+		{"Prefix", "http: ", 0},
+		{"StdFlags", "", log.LstdFlags},
+		{"All", "db ", log.Ldate | log.Lmicroseconds | log.Lshortfile},
+		{"LongFile", "", log.Ltime | log.Llongfile},
+		{"MsgPrefix", "[db] ", log.LstdFlags | log.Lshortfile | log.Lmsgprefix},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := NewStructured()
+			logger.SetWriter(&buf)
+
+			w := NewStdLogWriter(logger, LevelWarn)
+			w.SetPrefix(tt.prefix)
+			w.SetFlags(tt.flags)
+			log.New(w, tt.prefix, tt.flags).Printf("accept error: %s", "EOF")
+
+			level, msg := decodeStdLog(t, buf.Bytes())
+			if level != LevelWarn || msg != "accept error: EOF" {
+				t.Errorf("got %v %q", level, msg)
+			}
+		})
+	}
+}
+
+func TestStdLogLevelTags(t *testing.T) {
+	tests := []struct {
+		line  string
+		level Level
+		msg   string
+	}{
+		{"[DEBUG] a", LevelDebug, "a"},
+		{"[info] a", LevelInfo, "a"},
+		{"[Warning]   a", LevelWarn, "a"},
+		{"[ERR] a", LevelError, "a"},
+		{"[FATAL]a", LevelFatal, "a"},
+		{"[db] a", LevelInfo, "[db] a"},
+		{"[WARN a", LevelInfo, "[WARN a"},
+		{"[] a", LevelInfo, "[] a"},
+		{"[VERYLONGTAG] a", LevelInfo, "[VERYLONGTAG] a"},
+	}
+
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+	logger.SetLevel(LevelDebug)
+	std := NewStdLog(logger, LevelInfo)
+
+	for _, tt := range tests {
+		buf.Reset()
+		std.Print(tt.line)
+		level, msg := decodeStdLog(t, buf.Bytes())
+		if level != tt.level || msg != tt.msg {
+			t.Errorf("%q: got %v %q, want %v %q", tt.line, level, msg, tt.level, tt.msg)
+		}
+	}
+}
+
+func TestStdLogLevelDetectionDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+
+	w := NewStdLogWriter(logger, LevelInfo)
+	w.SetLevelDetectionEnabled(false)
+	log.New(w, "", 0).Print("[ERROR] a")
+
+	level, msg := decodeStdLog(t, buf.Bytes())
+	if level != LevelInfo || msg != "[ERROR] a" {
+		t.Errorf("got %v %q", level, msg)
+	}
+}
+
+func TestStdLogFiltered(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+	logger.SetLevel(LevelWarn)
+	std := NewStdLog(logger, LevelInfo)
+
+	std.Print("dropped")
+	std.Print("[DEBUG] dropped")
+	if buf.Len() != 0 {
+		t.Fatalf("expected no output, got %q", buf.Bytes())
+	}
+	std.Print("[WARN] kept")
+	if _, msg := decodeStdLog(t, buf.Bytes()); msg != "kept" {
+		t.Errorf("got %q", msg)
+	}
+}
+
+func TestStdLogCaller(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+	logger.SetCallerEnabled(true)
+	std := NewStdLog(logger, LevelInfo)
+
+	want := nextLine()
+	std.Printf("x %d", 1)
+	if got := decodeCaller(t, buf.Bytes()); got != want {
+		t.Errorf("caller = %s, want %s", got, want)
+	}
+}
+
+func TestStdLogJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&buf))
+
+	NewStdLog(logger, LevelError).Println("tls: handshake failed")
+	out := buf.String()
+	if !strings.Contains(out, `"level":"error"`) || !strings.HasSuffix(out, `"msg":"tls: handshake failed"}`+"\n") {
+		t.Errorf("unexpected output %s", out)
+	}
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(&buf)
+	prev := Default()
+	SetDefault(logger)
+	defer SetDefault(prev)
+
+	out, flags := log.Writer(), log.Flags()
+	undo := RedirectStdLog()
+	log.Print("[WARN] disk almost full")
+	undo()
+
+	level, msg := decodeStdLog(t, buf.Bytes())
+	if level != LevelWarn || msg != "disk almost full" {
+		t.Errorf("got %v %q", level, msg)
+	}
+	if log.Writer() != out || log.Flags() != flags {
+		t.Error("undo did not restore the standard logger")
+	}
+}
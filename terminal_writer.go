@@ -1,7 +1,7 @@
 package zlog
 
 import (
-	"fmt"
+	"bytes"
 	"io"
 	"os"
 	"sync"
@@ -58,6 +58,7 @@ type TerminalWriter struct {
 	out        io.Writer
 	useColor   bool
 	timeFormat string
+	enc        valueEncoding
 
 	// Pre-allocated buffer - reused for each write
 	buf []byte
@@ -85,62 +86,9 @@ func NewTerminalWriter(out io.Writer) *TerminalWriter {
 	}
 }
 
-// Write decodes binary log and outputs formatted text
+// Write decodes binary log and outputs formatted text.
+// b may hold several consecutive records.
 func (w *TerminalWriter) Write(b []byte) (int, error) {
-	if len(b) < 16 { // Minimum header size
-		return 0, fmt.Errorf("invalid log entry: too short")
-	}
-
-	// Decode binary header
-	// Check for MagicHeader (ZLOG)
-	magic := *(*uint32)(unsafe.Pointer(&b[0]))
-	if magic != MagicHeader {
-		return 0, fmt.Errorf("invalid magic header")
-	}
-
-	// version := b[4] // Currently unused
-	level := Level(b[5])
-
-	var timestamp uint64
-	var msgLen int
-	var msgStart int
-
-	// Try to detect format by looking at the data
-	// Basic logger: 16-byte header with 2-byte msgLen at offset 14
-	// Structured logger: 22-byte header with 1-byte msgLen at offset 22
-
-	// Try basic format first (most common)
-	if len(b) >= 16 {
-		possibleMsgLen := int(*(*uint16)(unsafe.Pointer(&b[14])))
-		if possibleMsgLen > 0 && possibleMsgLen <= 65535 && len(b) >= 16+possibleMsgLen {
-			// Looks like basic format
-			timestamp = *(*uint64)(unsafe.Pointer(&b[6]))
-			msgLen = possibleMsgLen
-			msgStart = 16
-		} else if len(b) >= 23 {
-			// Try structured format
-			possibleMsgLen = int(b[22])
-			if len(b) >= 23+possibleMsgLen {
-				// Looks like structured format
-				timestamp = *(*uint64)(unsafe.Pointer(&b[14]))
-				msgLen = possibleMsgLen
-				msgStart = 23
-			} else {
-				return 0, fmt.Errorf("invalid log entry: cannot determine format")
-			}
-		} else {
-			return 0, fmt.Errorf("invalid log entry: message truncated")
-		}
-	} else {
-		return 0, fmt.Errorf("invalid log format: too short")
-	}
-
-	// Get message
-	var msgEnd int
-	if msgLen > 0 {
-		msgEnd = msgStart + msgLen
-	}
-
 	// Lock to use our pre-allocated buffer
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -148,6 +96,28 @@ func (w *TerminalWriter) Write(b []byte) (int, error) {
 	// Reset buffer
 	buf := w.buf[:0]
 
+	var rec Record
+	for pos := 0; pos < len(b); {
+		n, err := DecodeRecord(b[pos:], &rec)
+		if err != nil {
+			return 0, err
+		}
+		pos += n
+		buf = w.appendRecord(buf, &rec)
+	}
+
+	// Save expanded buffer for reuse
+	w.buf = buf
+
+	// Write to output
+	_, err := w.out.Write(buf)
+	return len(b), err
+}
+
+// appendRecord formats a decoded record as one terminal line
+func (w *TerminalWriter) appendRecord(buf []byte, rec *Record) []byte {
+	level := rec.Level
+
 	// Format level with color
 	if w.useColor && level < 5 {
 		buf = append(buf, levelColors[level]...)
@@ -161,77 +131,105 @@ func (w *TerminalWriter) Write(b []byte) (int, error) {
 
 	// Format timestamp
 	buf = append(buf, '[')
-	t := time.Unix(0, int64(timestamp))
+	t := time.Unix(0, rec.Time)
 	buf = t.AppendFormat(buf, w.timeFormat)
 	buf = append(buf, "] "...)
 
 	// Add message
-	if msgEnd > msgStart {
-		buf = append(buf, b[msgStart:msgEnd]...)
-	}
-
-	// Check if we have fields (for structured logger)
-	pos := msgStart + msgLen
+	buf = append(buf, rec.Message...)
 
 	// Add padding if we have fields
-	if pos < len(b) && msgEnd-msgStart < termMsgJust {
-		padding := termMsgJust - (msgEnd - msgStart)
+	if rec.NumFields > 0 && len(rec.Message) < termMsgJust {
+		padding := termMsgJust - len(rec.Message)
 		if padding > 0 && padding <= len(spaces) {
 			buf = append(buf, spaces[:padding]...)
 		}
 	}
 
-	// Decode fields if present
-	if pos < len(b) {
-		fieldCount := int(b[pos])
-		pos++
-
-		for i := 0; i < fieldCount && pos < len(b); i++ {
-			if i > 0 {
-				buf = append(buf, ' ')
-			}
+	// Decode fields
+	fr := rec.fieldReader()
+	for i := 0; ; i++ {
+		f, ok := fr.next()
+		if !ok {
+			break
+		}
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = w.appendField(buf, level, f.key, f.typ, f.val)
+	}
 
-			// Get key
-			keyLen := int(b[pos])
-			pos++
-			if pos+keyLen > len(b) {
-				break
-			}
-			keyStart := pos
-			keyEnd := pos + keyLen
-			pos += keyLen
+	// Call site last, uncolored
+	if file, line, _, ok := rec.Caller(); ok {
+		buf = append(buf, " caller="...)
+		buf = append(buf, file...)
+		buf = append(buf, ':')
+		buf = appendInt(buf, int64(line))
+	}
+	buf = append(buf, '\n')
 
-			if pos >= len(b) {
-				break
+	// Stack trace as an indented block below the line
+	if stack := rec.Stack(); stack != nil {
+		for len(stack) > 0 {
+			line := stack
+			if i := bytes.IndexByte(stack, '\n'); i >= 0 {
+				line, stack = stack[:i], stack[i+1:]
+			} else {
+				stack = nil
 			}
+			buf = append(buf, "    "...)
+			buf = append(buf, line...)
+			buf = append(buf, '\n')
+		}
+	}
 
-			fieldType := FieldType(b[pos])
-			pos++
+	return buf
+}
 
-			// Format key with color
-			if w.useColor && level < 5 {
-				buf = append(buf, levelColors[level]...)
-				buf = append(buf, b[keyStart:keyEnd]...)
-				buf = append(buf, colorResetBytes...)
-				buf = append(buf, '=')
-			} else {
-				buf = append(buf, b[keyStart:keyEnd]...)
-				buf = append(buf, '=')
+// appendField formats a key=value pair. Objects and arrays are flattened
+// into space-separated pairs with dotted keys.
+func (w *TerminalWriter) appendField(buf []byte, level Level, key []byte, t FieldType, val []byte) []byte {
+	if isNested(t) {
+		_, data := decodeValue(t, val)
+		fr := nestedReader(data)
+		if fr.n > 0 {
+			var keyBuf [128]byte
+			for i := 0; ; i++ {
+				f, ok := fr.next()
+				if !ok {
+					break
+				}
+				if i > 0 {
+					buf = append(buf, ' ')
+				}
+				sub := appendNestedKey(keyBuf[:0], key, t, f.key, i)
+				buf = w.appendField(buf, level, sub, f.typ, f.val)
 			}
-
-			// Decode value
-			buf, pos = w.decodeFieldValueBuf(buf, b, pos, fieldType)
+			return buf
 		}
 	}
 
-	buf = append(buf, '\n')
+	// Format key with color
+	if w.useColor && level < 5 {
+		buf = append(buf, levelColors[level]...)
+		buf = append(buf, key...)
+		buf = append(buf, colorResetBytes...)
+		buf = append(buf, '=')
+	} else {
+		buf = append(buf, key...)
+		buf = append(buf, '=')
+	}
 
-	// Save expanded buffer for reuse
-	w.buf = buf
+	switch t {
+	case FieldTypeObject:
+		return append(buf, "{}"...)
+	case FieldTypeArray:
+		return append(buf, "[]"...)
+	}
 
-	// Write to output
-	_, err := w.out.Write(buf)
-	return len(b), err
+	// Decode value
+	buf, _ = w.decodeFieldValueBuf(buf, val, 0, t)
+	return buf
 }
 
 // decodeFieldValueBuf decodes a field value from binary into buffer
@@ -305,11 +303,61 @@ func (w *TerminalWriter) decodeFieldValueBuf(buf, b []byte, pos int, fieldType F
 		buf = appendHex(buf, b[pos+2:pos+2+blen])
 		return buf, pos + 2 + blen
 
+	case FieldTypeTime, FieldTypeDuration:
+		if len(b)-pos < 8 {
+			return append(buf, '?'), pos + 8
+		}
+		v := int64(bigEndianUint64(b[pos:]))
+		if fieldType == FieldTypeTime {
+			return appendTimeValue(buf, v, w.enc.time, false), pos + 8
+		}
+		return appendDurationValue(buf, v, w.enc.duration, false), pos + 8
+
+	case FieldTypeError:
+		if len(b)-pos < 2 {
+			return append(buf, '?'), pos + 2
+		}
+		elen := int(uint16(b[pos])<<8 | uint16(b[pos+1]))
+		if len(b)-pos < 2+elen {
+			return append(buf, '?'), pos + 2 + elen
+		}
+		buf = w.appendError(buf, b[pos+2:pos+2+elen])
+		return buf, pos + 2 + elen
+
 	default:
 		return append(buf, '?'), pos
 	}
 }
 
+// appendError formats an error as its message followed by its detail
+// fields in braces
+func (w *TerminalWriter) appendError(buf, data []byte) []byte {
+	p, ok := decodeErrorPayload(data)
+	if !ok {
+		return append(buf, '?')
+	}
+	buf = escapeStringOptimized(buf, p.message())
+	if p.nFields == 0 {
+		return buf
+	}
+
+	buf = append(buf, " {"...)
+	fr := p.fieldReader()
+	for i := 0; ; i++ {
+		f, ok := fr.next()
+		if !ok {
+			break
+		}
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, f.key...)
+		buf = append(buf, '=')
+		buf, _ = w.decodeFieldValueBuf(buf, f.val, 0, f.typ)
+	}
+	return append(buf, '}')
+}
+
 // escapeStringOptimized escapes string without allocation
 func escapeStringOptimized(buf []byte, s []byte) []byte {
 	// Fast path - scan for special characters using optimized loop
@@ -487,11 +535,11 @@ func (w *TerminalWriter) getLevelString(level Level) string {
 // fieldValueSize returns the size of a field value in bytes (kept for compatibility)
 func (w *TerminalWriter) fieldValueSize(b []byte, fieldType FieldType) int {
 	switch fieldType {
-	case FieldTypeInt, FieldTypeUint, FieldTypeBool, FieldTypeFloat64:
+	case FieldTypeInt, FieldTypeUint, FieldTypeBool, FieldTypeFloat64, FieldTypeTime, FieldTypeDuration:
 		return 8
 	case FieldTypeFloat32:
 		return 4
-	case FieldTypeString, FieldTypeBytes:
+	case FieldTypeString, FieldTypeBytes, FieldTypeError, FieldTypeObject, FieldTypeArray:
 		if len(b) >= 2 {
 			return 2 + int(uint16(b[0])<<8|uint16(b[1]))
 		}
@@ -518,6 +566,20 @@ func StderrTerminal() io.Writer {
 	return NewTerminalWriter(os.Stderr)
 }
 
+// SetTimeEncoding sets how time fields are formatted
+func (w *TerminalWriter) SetTimeEncoding(enc TimeEncoding) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.enc.time = enc
+}
+
+// SetDurationEncoding sets how duration fields are formatted
+func (w *TerminalWriter) SetDurationEncoding(enc DurationEncoding) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.enc.duration = enc
+}
+
 // SetColorEnabled allows manually enabling/disabling colors
 func (w *TerminalWriter) SetColorEnabled(enabled bool) {
 	w.mu.Lock()
@@ -0,0 +1,258 @@
+package zlog
+
+import (
+	"encoding/base64"
+	"math"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+// Text encodings shared by the decoding writers (JSONWriter, LogfmtWriter)
+// and by loggers that encode straight to text with SetFormat. Both paths
+// produce identical output for the same record.
+
+// data returns the payload of a string or bytes field
+//
+//go:inline
+func (f *Field) data() []byte {
+	switch f.Type {
+	case FieldTypeString, FieldTypeError:
+		return StringToBytes(f.str)
+	case FieldTypeBytes:
+		if f.ptr == nil {
+			return nil
+		}
+		return unsafe.Slice((*byte)(f.ptr), int(f.num))
+	}
+	return nil
+}
+
+// decodeValue splits an encoded field value into its numeric bits and
+// payload, the same representation Field uses
+//
+//go:inline
+func decodeValue(t FieldType, v []byte) (num uint64, data []byte) {
+	switch t {
+	case FieldTypeFloat32:
+		return uint64(uint32(v[0])<<24 | uint32(v[1])<<16 | uint32(v[2])<<8 | uint32(v[3])), nil
+	case FieldTypeString, FieldTypeBytes, FieldTypeError, FieldTypeObject, FieldTypeArray:
+		return 0, v[2:]
+	default:
+		if len(v) < 8 {
+			return 0, nil
+		}
+		return bigEndianUint64(v), nil
+	}
+}
+
+// appendJSONHeader opens a JSON object and appends the record-level keys.
+// A zero timestamp means the record has no time.
+func appendJSONHeader(buf []byte, keys *JSONKeys, level Level, ts int64, seq uint64, msg []byte) []byte {
+	buf = append(buf, '{')
+	first := true
+
+	if keys.Time != "" && ts != 0 {
+		buf = appendJSONKey(buf, keys.Time, &first)
+		buf = append(buf, '"')
+		buf = time.Unix(0, ts).UTC().AppendFormat(buf, time.RFC3339Nano)
+		buf = append(buf, '"')
+	}
+	if keys.Level != "" {
+		buf = appendJSONKey(buf, keys.Level, &first)
+		buf = append(buf, '"')
+		buf = append(buf, getLevelString(level)...)
+		buf = append(buf, '"')
+	}
+	if keys.Sequence != "" && seq != 0 {
+		buf = appendJSONKey(buf, keys.Sequence, &first)
+		buf = strconv.AppendUint(buf, seq, 10)
+	}
+	if keys.Message != "" {
+		buf = appendJSONKey(buf, keys.Message, &first)
+		buf = appendJSONString(buf, msg)
+	}
+	return buf
+}
+
+// appendJSONField appends a key and value to an open JSON object
+func appendJSONField(buf []byte, key []byte, t FieldType, num uint64, data []byte, enc *valueEncoding) []byte {
+	// A value never ends in '{', so this is only true for an empty object
+	first := buf[len(buf)-1] == '{'
+	buf = appendJSONKey(buf, BytesToString(key), &first)
+	return appendJSONValue(buf, t, num, data, enc)
+}
+
+// appendJSONValue appends a field value as JSON
+func appendJSONValue(buf []byte, t FieldType, num uint64, data []byte, enc *valueEncoding) []byte {
+	switch t {
+	case FieldTypeInt:
+		return strconv.AppendInt(buf, int64(num), 10)
+	case FieldTypeUint:
+		return strconv.AppendUint(buf, num, 10)
+	case FieldTypeBool:
+		return strconv.AppendBool(buf, num != 0)
+	case FieldTypeFloat32:
+		return appendJSONFloat(buf, float64(math.Float32frombits(uint32(num))), 32)
+	case FieldTypeFloat64:
+		return appendJSONFloat(buf, math.Float64frombits(num), 64)
+	case FieldTypeString:
+		return appendJSONString(buf, data)
+	case FieldTypeBytes:
+		buf = append(buf, '"')
+		if enc.bytes == BytesHex {
+			buf = appendHex(buf, data)
+		} else {
+			buf = base64.StdEncoding.AppendEncode(buf, data)
+		}
+		return append(buf, '"')
+	case FieldTypeError:
+		return appendJSONError(buf, data, enc)
+	case FieldTypeObject, FieldTypeArray:
+		return appendJSONNested(buf, t, data, enc)
+	case FieldTypeTime:
+		return appendTimeValue(buf, int64(num), enc.time, true)
+	case FieldTypeDuration:
+		return appendDurationValue(buf, int64(num), enc.duration, true)
+	default:
+		return append(buf, "null"...)
+	}
+}
+
+// appendLogfmtHeader appends the time, level and msg pairs of a logfmt line.
+// A zero timestamp means the record has no time.
+func appendLogfmtHeader(buf []byte, level Level, ts int64, msg []byte) []byte {
+	if ts != 0 {
+		buf = append(buf, "time="...)
+		buf = time.Unix(0, ts).AppendFormat(buf, time.RFC3339)
+		buf = append(buf, ' ')
+	}
+
+	buf = append(buf, "level="...)
+	buf = append(buf, getLevelString(level)...)
+
+	buf = append(buf, " msg="...)
+	return appendQuoted(buf, BytesToString(msg))
+}
+
+// appendLogfmtField appends a key=value pair to a logfmt line
+func appendLogfmtField(buf []byte, key []byte, t FieldType, num uint64, data []byte, enc *valueEncoding) []byte {
+	if isNested(t) {
+		return appendLogfmtNested(buf, key, t, data, enc)
+	}
+	buf = append(buf, ' ')
+	buf = append(buf, key...)
+	buf = append(buf, '=')
+	if t == FieldTypeError {
+		return appendLogfmtError(buf, key, data, enc)
+	}
+	return appendLogfmtValue(buf, t, num, data, enc)
+}
+
+// appendLogfmtValue appends a field value in logfmt
+func appendLogfmtValue(buf []byte, t FieldType, num uint64, data []byte, enc *valueEncoding) []byte {
+	switch t {
+	case FieldTypeInt:
+		return strconv.AppendInt(buf, int64(num), 10)
+	case FieldTypeUint:
+		return strconv.AppendUint(buf, num, 10)
+	case FieldTypeBool:
+		return strconv.AppendBool(buf, num != 0)
+	case FieldTypeFloat32:
+		return strconv.AppendFloat(buf, float64(math.Float32frombits(uint32(num))), 'g', -1, 32)
+	case FieldTypeFloat64:
+		return strconv.AppendFloat(buf, math.Float64frombits(num), 'g', -1, 64)
+	case FieldTypeString:
+		return appendQuoted(buf, BytesToString(data))
+	case FieldTypeBytes:
+		return appendHex(buf, data)
+	case FieldTypeTime:
+		return appendTimeValue(buf, int64(num), enc.time, false)
+	case FieldTypeDuration:
+		return appendDurationValue(buf, int64(num), enc.duration, false)
+	default:
+		return append(buf, '?')
+	}
+}
+
+// textEncoder encodes records directly in a text format, skipping the
+// binary round-trip
+type textEncoder struct {
+	format LogFormat
+}
+
+// begin appends the record-level part of a record
+//
+//go:inline
+func (e textEncoder) begin(buf []byte, level Level, ts int64, seq uint64, msg string) []byte {
+	if e.format == FormatJSON {
+		return appendJSONHeader(buf, &DefaultJSONKeys, level, ts, seq, StringToBytes(msg))
+	}
+	return appendLogfmtHeader(buf, level, ts, StringToBytes(msg))
+}
+
+// context appends pre-encoded context fields
+//
+//go:inline
+func (e textEncoder) context(buf []byte, ctx *contextFields) []byte {
+	if ctx == nil {
+		return buf
+	}
+	if e.format != FormatJSON {
+		return append(buf, ctx.logfmt...)
+	}
+	if len(ctx.json) > 0 && buf[len(buf)-1] == '{' {
+		return append(buf, ctx.json[1:]...) // No separator in an empty object
+	}
+	return append(buf, ctx.json...)
+}
+
+// field appends a field
+//
+//go:inline
+func (e textEncoder) field(buf []byte, f *Field) []byte {
+	if f.Type == fieldTypeLazy {
+		r := f.resolve()
+		return e.field(buf, &r)
+	}
+	if isNested(f.Type) || f.obj != nil {
+		// Render from the binary encoding so output matches the writers
+		data, bufPtr := encodeNestedValue(f)
+		buf = e.value(buf, f, data)
+		PutBuffer(bufPtr)
+		return buf
+	}
+	return e.value(buf, f, f.data())
+}
+
+// value appends a field with its payload
+//
+//go:inline
+func (e textEncoder) value(buf []byte, f *Field, data []byte) []byte {
+	if e.format == FormatJSON {
+		return appendJSONField(buf, StringToBytes(f.Key), f.Type, f.num, data, &defaultValueEncoding)
+	}
+	return appendLogfmtField(buf, StringToBytes(f.Key), f.Type, f.num, data, &defaultValueEncoding)
+}
+
+// end appends the record attributes and terminates the record
+//
+//go:inline
+func (e textEncoder) end(buf []byte, attrs *recordAttrs) []byte {
+	if e.format == FormatJSON {
+		if attrs.caller != nil && DefaultJSONKeys.Caller != "" {
+			buf = appendJSONField(buf, StringToBytes(DefaultJSONKeys.Caller), FieldTypeString, 0, attrs.caller.text, &defaultValueEncoding)
+		}
+		if attrs.stack != nil && DefaultJSONKeys.Stack != "" {
+			buf = appendJSONField(buf, StringToBytes(DefaultJSONKeys.Stack), FieldTypeString, 0, attrs.stack, &defaultValueEncoding)
+		}
+		return append(buf, '}', '\n')
+	}
+	if attrs.caller != nil {
+		buf = appendLogfmtField(buf, callerKey, FieldTypeString, 0, attrs.caller.text, &defaultValueEncoding)
+	}
+	if attrs.stack != nil {
+		buf = appendLogfmtField(buf, stackKey, FieldTypeString, 0, attrs.stack, &defaultValueEncoding)
+	}
+	return append(buf, '\n')
+}
@@ -4,7 +4,8 @@ import (
 	"io"
 	"os"
 	"sync/atomic"
-	"unsafe"
+	"time"
+	_ "unsafe" // for go:linkname
 )
 
 // Level represents logging severity
@@ -21,25 +22,37 @@ const (
 // Constants
 const (
 	MagicHeader   uint32 = 0x5A4C4F47 // "ZLOG"
-	Version       byte   = 1
-	CacheLineSize        = 64 // CPU cache line size
+	Version       byte   = 2          // Binary record format version
+	CacheLineSize        = 64         // CPU cache line size
 )
 
 // Logger is a simple high-performance logger
 type Logger struct {
-	format LogFormat
-	level  atomic.Uint32
-	writer Writer
+	format    LogFormat
+	level     atomic.Uint32
+	writer    atomicWriter
+	errs      writeErrors
+	clock     Clock
+	monotonic bool
+
+	// Caller capture, see SetCallerEnabled
+	caller     bool
+	callerSkip int
+
+	// Stack traces, see SetStackTraceEnabled
+	stack      bool
+	stackLevel Level
 	// Remove pool field - using global pool now
 }
 
 // New creates a new logger with auto-detected output format
 func New() *Logger {
 	l := &Logger{
-		format: FormatBinary,
-		writer: os.Stderr,
+		format:     FormatBinary,
+		stackLevel: LevelError,
 	}
 	l.level.Store(uint32(LevelInfo)) // Default to Info level
+	l.writer.Store(os.Stderr)
 	return l
 }
 
@@ -53,9 +66,64 @@ func (l *Logger) GetLevel() Level {
 	return Level(l.level.Load())
 }
 
-// SetWriter sets the output writer
+// Enabled reports whether records at level are logged
+func (l *Logger) Enabled(level Level) bool {
+	return l.shouldLog(level)
+}
+
+// SetWriter sets the output writer. It is safe to call while other
+// goroutines log, e.g. to reopen a file on SIGHUP.
 func (l *Logger) SetWriter(w Writer) {
-	l.writer = w
+	l.writer.Store(w)
+}
+
+// SwapWriter sets the output writer and returns the previous one once the
+// writes running on it have finished, so it can be flushed or closed. It
+// must not be called from the previous writer's Write method.
+func (l *Logger) SwapWriter(w Writer) Writer {
+	return l.writer.Swap(w)
+}
+
+// SetErrorHandler sets the handler for errors of the writer, nil for the
+// package default set by SetDefaultErrorHandler. Set it before the logger
+// is shared between goroutines.
+func (l *Logger) SetErrorHandler(h ErrorHandler) {
+	l.errs.handler = h
+}
+
+// SetStderrFailover replaces the writer with stderr after n consecutive
+// failed writes, 0 to never fail over. The record that failed last is
+// written again to stderr, and the error handler is called with an error
+// wrapping ErrStderrFailover. Binary records are written as logfmt. Set it
+// before the logger is shared between goroutines.
+func (l *Logger) SetStderrFailover(n int) {
+	l.errs.failover = n
+}
+
+// SetFormat sets the output format. FormatJSON and FormatText (logfmt)
+// records are encoded straight into text, producing the same lines as
+// JSONWriter and LogfmtWriter without the binary round-trip. Set it before
+// the logger is shared between goroutines.
+func (l *Logger) SetFormat(format LogFormat) {
+	l.format = format
+}
+
+// GetFormat returns the output format
+func (l *Logger) GetFormat() LogFormat {
+	return l.format
+}
+
+// SetClock sets the clock used to timestamp records; nil selects the
+// system clock. Set it before the logger is shared between goroutines.
+func (l *Logger) SetClock(c Clock) {
+	l.clock = c
+}
+
+// SetMonotonicEnabled adds a monotonic clock reading to every record, for
+// ordering records independently of wall-clock adjustments. Set it before
+// the logger is shared between goroutines.
+func (l *Logger) SetMonotonicEnabled(enabled bool) {
+	l.monotonic = enabled
 }
 
 // shouldLog checks if the given level should be logged
@@ -65,7 +133,7 @@ func (l *Logger) shouldLog(level Level) bool {
 
 // getWriter returns the current writer
 func (l *Logger) getWriter() Writer {
-	return l.writer
+	return l.writer.Load()
 }
 
 // Debug logs a debug message
@@ -108,16 +176,25 @@ func (l *Logger) Fatal(msg string) {
 
 // log is the core logging function
 func (l *Logger) log(level Level, msg string) {
+	attrs := l.attrs(level)
+	if l.format != FormatBinary {
+		l.logText(level, clockNow(l.clock), 0, msg, nil, nil, &attrs)
+		attrs.release()
+		return
+	}
+
 	msgLen := len(msg)
-	requiredSize := 16 + msgLen
+	if msgLen > maxMessageLen {
+		msgLen = maxMessageLen
+	}
+	requiredSize := recordHeaderSize + 4 + msgLen + l.attrSize(&attrs)
 
 	// For small messages, use stack allocation
 	if requiredSize <= 256 {
 		var stackBuf [256]byte
-		l.formatMessage(stackBuf[:requiredSize], level, msg)
-		if l.writer != nil {
-			l.writer.Write(stackBuf[:requiredSize])
-		}
+		l.formatMessage(stackBuf[:requiredSize], level, msg, &attrs)
+		attrs.release()
+		writeRecord(&l.writer, &l.errs, level, stackBuf[:requiredSize], false)
 		return
 	}
 
@@ -126,44 +203,141 @@ func (l *Logger) log(level Level, msg string) {
 	buf := (*bufPtr)[:requiredSize]
 
 	// Format message
-	l.formatMessage(buf[:requiredSize], level, msg)
+	l.formatMessage(buf[:requiredSize], level, msg, &attrs)
+	attrs.release()
 
 	// Write
-	if l.writer != nil {
-		l.writer.Write(buf[:requiredSize])
-	}
+	writeRecord(&l.writer, &l.errs, level, buf[:requiredSize], false)
 
 	// Return buffer to pool
 	PutBuffer(bufPtr)
 }
 
-// formatMessage formats the log message into the buffer
+// logText encodes a record straight into the configured text format
+func (l *Logger) logText(level Level, ts int64, seq uint64, msg string, ctx *contextFields, fields []Field, attrs *recordAttrs) {
+	size := 128 + len(msg) + attrs.textSize()
+	if ctx != nil {
+		size += len(ctx.json)
+	}
+	for i := range fields {
+		if isNested(fields[i].Type) {
+			size += 64 // Sizing would marshal it an extra time
+			continue
+		}
+		size += 16 + fieldSize(&fields[i])
+	}
+
+	enc := textEncoder{format: l.format}
+	bufPtr := GetBuffer(size)
+	buf := enc.begin((*bufPtr)[:0], level, ts, seq, msg)
+	buf = enc.context(buf, ctx)
+	for i := range fields {
+		buf = enc.field(buf, &fields[i])
+	}
+	buf = enc.end(buf, attrs)
+
+	writeRecord(&l.writer, &l.errs, level, buf, true)
+
+	*bufPtr = buf
+	PutBuffer(bufPtr)
+}
+
+// formatMessage formats the log message into the buffer, which must be
+// exactly the size of the record
 //
 //go:inline
-func (l *Logger) formatMessage(buf []byte, level Level, msg string) {
-	// Header
-	*(*uint32)(unsafe.Pointer(&buf[0])) = MagicHeader
-	buf[4] = Version
-	buf[5] = byte(level)
-	*(*uint64)(unsafe.Pointer(&buf[6])) = uint64(nanotime())
-	*(*uint16)(unsafe.Pointer(&buf[14])) = uint16(len(msg))
+func (l *Logger) formatMessage(buf []byte, level Level, msg string, attrs *recordAttrs) {
+	var flags RecordFlags
 
-	// Message
-	copy(buf[16:], msg)
+	pos := writeBinaryHeader(buf, level, 0, clockNow(l.clock))
+	pos, truncated := writeMessage(buf[:len(buf)-l.attrSize(attrs)], pos, msg)
+	if truncated {
+		flags |= FlagTruncated
+	}
+	setFieldCount(buf, pos, 0)
+	pos, flags = l.writeAttrs(buf, pos+2, flags, attrs)
+	finishRecord(buf, pos, flags)
 }
 
 // LogFormat represents the output format
 type LogFormat int
 
 const (
-	FormatBinary LogFormat = iota
-	FormatText
-	FormatJSON
+	FormatBinary LogFormat = iota // Binary records, decoded by writers
+	FormatText                    // logfmt lines
+	FormatJSON                    // Newline-delimited JSON
 )
 
 // Writer is an alias for io.Writer to avoid interface conversions
 type Writer = io.Writer
 
+// atomicWriter holds a writer that can be replaced while other goroutines
+// write to it. The writer is boxed with a count of the writes running on
+// it, so a replaced writer can be handed back once it is idle.
+type atomicWriter struct {
+	p atomic.Pointer[writerBox]
+}
+
+type writerBox struct {
+	w        Writer
+	inflight atomic.Int64 // Writes running on w
+}
+
+// Load returns the current writer, nil if none is set
+//
+//go:inline
+func (a *atomicWriter) Load() Writer {
+	if b := a.p.Load(); b != nil {
+		return b.w
+	}
+	return nil
+}
+
+// Store replaces the writer
+func (a *atomicWriter) Store(w Writer) {
+	a.p.Store(&writerBox{w: w})
+}
+
+// Swap replaces the writer and returns the previous one once the writes
+// running on it have finished
+func (a *atomicWriter) Swap(w Writer) Writer {
+	b := a.p.Swap(&writerBox{w: w})
+	if b == nil {
+		return nil
+	}
+	for wait := time.Microsecond; b.inflight.Load() > 0; wait = min(2*wait, flushPollMax) {
+		time.Sleep(wait)
+	}
+	return b.w
+}
+
+// acquire returns the box of the current writer with a write counted on
+// it, nil if no writer is set. The caller ends the write with release.
+//
+//go:inline
+func (a *atomicWriter) acquire() *writerBox {
+	for {
+		b := a.p.Load()
+		if b == nil || b.w == nil {
+			return nil
+		}
+		b.inflight.Add(1)
+		// A Swap since the load may have missed the count; the write then
+		// goes to the new writer
+		if a.p.Load() == b {
+			return b
+		}
+		b.release()
+	}
+}
+
+// release ends a write counted by acquire
+//
+//go:inline
+func (b *writerBox) release() {
+	b.inflight.Add(-1)
+}
+
 // Runtime functions
 //
 //go:linkname nanotime runtime.nanotime
@@ -29,6 +29,17 @@ func BenchmarkUltimateLoggerParallel(b *testing.B) {
 	})
 }
 
+func BenchmarkUltimateLogIntString(b *testing.B) {
+	logger := NewUltimateLogger()
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		logger.LogIntString(LevelInfo, "request", "status", 200, "path", "/api/users")
+	}
+}
+
 // Benchmark raw operations for comparison
 func BenchmarkRawMemcpy(b *testing.B) {
 	src := "benchmark message"
@@ -0,0 +1,84 @@
+package zlog
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestUltimateLoggerLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewUltimateLogger()
+	logger.SetWriter(&buf)
+	logger.SetLevel(LevelWarn)
+
+	if logger.GetLevel() != LevelWarn {
+		t.Errorf("GetLevel() = %v", logger.GetLevel())
+	}
+	for level, want := range map[Level]bool{LevelDebug: false, LevelInfo: false, LevelWarn: true, LevelError: true, LevelFatal: true} {
+		if logger.Enabled(level) != want {
+			t.Errorf("Enabled(%v) = %v", level, !want)
+		}
+	}
+
+	logger.Debug("dropped")
+	logger.Info("dropped")
+	logger.Warn("warn")
+	logger.Error("error")
+
+	var levels []Level
+	for b := buf.Bytes(); len(b) > 0; {
+		var rec Record
+		n, err := DecodeRecord(b, &rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		levels = append(levels, rec.Level)
+		b = b[n:]
+	}
+	if len(levels) != 2 || levels[0] != LevelWarn || levels[1] != LevelError {
+		t.Errorf("logged levels %v", levels)
+	}
+}
+
+func TestLoggerEnabled(t *testing.T) {
+	logger := NewStructured()
+	logger.SetLevel(LevelError)
+	if logger.Enabled(LevelWarn) || !logger.Enabled(LevelError) {
+		t.Error("Enabled does not follow the level")
+	}
+}
+
+func TestUltimateLogIntString(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewUltimateLogger()
+	logger.SetWriter(NewJSONWriter(&buf))
+
+	logger.LogIntString(LevelInfo, "request", "status", 200, "path", "/api/users")
+	logger.LogIntString(LevelDebug, "dropped", "status", 0, "path", "")
+
+	out := buf.String()
+	if strings.Count(out, "\n") != 1 {
+		t.Fatalf("expected one record, got %s", out)
+	}
+	if !strings.Contains(out, `"level":"info"`) || !strings.HasSuffix(out, `"msg":"request","status":200,"path":"/api/users"}`+"\n") {
+		t.Errorf("unexpected output %s", out)
+	}
+}
+
+func TestUltimateLoggerZeroAlloc(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful under the race detector")
+	}
+	logger := NewUltimateLogger()
+	logger.SetWriter(io.Discard)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		logger.Info("message")
+		logger.LogIntString(LevelWarn, "request", "status", 503, "path", "/api/users")
+	})
+	if allocs != 0 {
+		t.Errorf("%.1f allocs per log", allocs)
+	}
+}
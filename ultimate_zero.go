@@ -2,6 +2,7 @@ package zlog
 
 import (
 	"io"
+	"os"
 	"sync/atomic"
 	"unsafe"
 )
@@ -9,16 +10,19 @@ import (
 // UltimateLogger - High-performance logger with zero allocations
 type UltimateLogger struct {
 	level    uint32
-	writer   io.Writer
+	writer   atomicWriter
+	errs     writeErrors
+	clock    Clock
 	sequence uint64
 }
 
 // NewUltimateLogger creates a zero-allocation logger
 func NewUltimateLogger() *UltimateLogger {
-	return &UltimateLogger{
-		level:  uint32(LevelInfo), // Default to Info level
-		writer: io.Discard,
+	l := &UltimateLogger{
+		level: uint32(LevelInfo), // Default to Info level
 	}
+	l.writer.Store(io.Discard)
+	return l
 }
 
 // SetLevel sets the log level
@@ -26,9 +30,46 @@ func (l *UltimateLogger) SetLevel(level Level) {
 	atomic.StoreUint32(&l.level, uint32(level))
 }
 
-// SetWriter sets the output writer
+// GetLevel returns the current log level
+func (l *UltimateLogger) GetLevel() Level {
+	return Level(atomic.LoadUint32(&l.level))
+}
+
+// Enabled reports whether records at level are logged
+func (l *UltimateLogger) Enabled(level Level) bool {
+	return atomic.LoadUint32(&l.level) <= uint32(level)
+}
+
+// SetWriter sets the output writer. It is safe to call while other
+// goroutines log.
 func (l *UltimateLogger) SetWriter(w io.Writer) {
-	l.writer = w
+	l.writer.Store(w)
+}
+
+// SwapWriter sets the output writer and returns the previous one once the
+// writes running on it have finished, so it can be flushed or closed. It
+// must not be called from the previous writer's Write method.
+func (l *UltimateLogger) SwapWriter(w io.Writer) io.Writer {
+	return l.writer.Swap(w)
+}
+
+// SetErrorHandler sets the handler for errors of the writer, nil for the
+// package default. Set it before the logger is shared between goroutines.
+func (l *UltimateLogger) SetErrorHandler(h ErrorHandler) {
+	l.errs.handler = h
+}
+
+// SetStderrFailover replaces the writer with a logfmt writer to stderr
+// after n consecutive failed writes, 0 to never fail over. Set it before
+// the logger is shared between goroutines.
+func (l *UltimateLogger) SetStderrFailover(n int) {
+	l.errs.failover = n
+}
+
+// SetClock sets the clock used to timestamp records; nil selects the
+// system clock. Set it before the logger is shared between goroutines.
+func (l *UltimateLogger) SetClock(c Clock) {
+	l.clock = c
 }
 
 // Info logs with zero allocations
@@ -52,6 +93,16 @@ func (l *UltimateLogger) Debug(msg string) {
 	l.log(LevelDebug, msg)
 }
 
+// Warn logs a warning message
+//
+//go:nosplit
+func (l *UltimateLogger) Warn(msg string) {
+	if atomic.LoadUint32(&l.level) > uint32(LevelWarn) {
+		return
+	}
+	l.log(LevelWarn, msg)
+}
+
 // Error logs an error message
 //
 //go:nosplit
@@ -62,61 +113,86 @@ func (l *UltimateLogger) Error(msg string) {
 	l.log(LevelError, msg)
 }
 
+// Fatal logs a fatal message and exits
+func (l *UltimateLogger) Fatal(msg string) {
+	l.log(LevelFatal, msg)
+	os.Exit(1)
+}
+
+// LogIntString logs msg at level with one int and one string field, the
+// shape of most request and status logs, without building Fields
+func (l *UltimateLogger) LogIntString(level Level, msg string, intKey string, intVal int, strKey, strVal string) {
+	if atomic.LoadUint32(&l.level) > uint32(level) {
+		return
+	}
+
+	fields := [2]Field{Int(intKey, intVal), String(strKey, strVal)}
+	msgLen := min(len(msg), maxMessageLen)
+	size := recordHeaderSize + 4 + msgLen + fieldSize(&fields[0]) + fieldSize(&fields[1])
+
+	bufPtr := GetBuffer(size)
+	buf := (*bufPtr)[:size]
+
+	seq := atomic.AddUint64(&l.sequence, 1)
+	pos := writeBinaryHeader(buf, level, seq, clockNow(l.clock))
+	pos, truncated := writeMessage(buf, pos, msg)
+	countPos := pos
+	pos += 2
+	pos += encodeField(buf[pos:], &fields[0])
+	pos += encodeField(buf[pos:], &fields[1])
+	setFieldCount(buf, countPos, 2)
+
+	var flags RecordFlags
+	if truncated {
+		flags |= FlagTruncated
+	}
+	finishRecord(buf, pos, flags)
+
+	writeRecord(&l.writer, &l.errs, level, buf[:pos], false)
+	PutBuffer(bufPtr)
+}
+
 // log is the common logging function
 //
 //go:nosplit
 func (l *UltimateLogger) log(level Level, msg string) {
 	msgLen := len(msg)
-	if msgLen > 200 {
-		msgLen = 200
+	if msgLen > maxMessageLen {
+		msgLen = maxMessageLen
 	}
 
-	requiredSize := 23 + msgLen
+	requiredSize := recordHeaderSize + 4 + msgLen
 
-	// For small messages, use stack allocation
-	if requiredSize <= 128 {
-		var stackBuf [128]byte
-		l.formatUltimateMessage(stackBuf[:requiredSize], level, msg, msgLen)
-		if l.writer != nil {
-			l.writer.Write(stackBuf[:requiredSize])
-		}
-		return
-	}
-
-	// Get buffer from pool
+	// Get buffer from pool. A stack buffer would escape through the
+	// writer interface.
 	bufPtr := GetBuffer(requiredSize)
 	buf := (*bufPtr)[:requiredSize]
 
 	// Format message
-	l.formatUltimateMessage(buf, level, msg, msgLen)
+	l.formatUltimateMessage(buf, level, msg)
 
 	// Write to output
-	if l.writer != nil {
-		l.writer.Write(buf)
-	}
+	writeRecord(&l.writer, &l.errs, level, buf, false)
 
 	// Return buffer to pool
 	PutBuffer(bufPtr)
 }
 
-// formatUltimateMessage formats the message into the buffer
+// formatUltimateMessage formats the message into the buffer, which must be
+// exactly the size of the record
 //
 //go:inline
-func (l *UltimateLogger) formatUltimateMessage(buf []byte, level Level, msg string, msgLen int) {
-	p := unsafe.Pointer(&buf[0])
-
-	*(*uint32)(p) = MagicHeader
-	*(*byte)(unsafe.Pointer(uintptr(p) + 4)) = Version
-	*(*byte)(unsafe.Pointer(uintptr(p) + 5)) = byte(level)
-
+func (l *UltimateLogger) formatUltimateMessage(buf []byte, level Level, msg string) {
 	seq := atomic.AddUint64(&l.sequence, 1)
-	*(*uint64)(unsafe.Pointer(uintptr(p) + 6)) = seq
-	*(*uint64)(unsafe.Pointer(uintptr(p) + 14)) = uint64(nanotime())
-	*(*byte)(unsafe.Pointer(uintptr(p) + 22)) = byte(msgLen)
+	pos := writeBinaryHeader(buf, level, seq, clockNow(l.clock))
+	pos, truncated := writeMessage(buf, pos, msg)
+	setFieldCount(buf, pos, 0)
 
-	if msgLen > 0 {
-		copy(buf[23:], msg[:msgLen])
+	var flags RecordFlags
+	if truncated {
+		flags |= FlagTruncated
 	}
+	finishRecord(buf, pos+2, flags)
 }
 
 // memmove copies memory (provided by runtime)
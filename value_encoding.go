@@ -0,0 +1,182 @@
+package zlog
+
+import (
+	"strconv"
+	"time"
+)
+
+// TimeEncoding selects how writers render time fields
+type TimeEncoding uint8
+
+const (
+	TimeRFC3339Nano TimeEncoding = iota // RFC 3339 with nanoseconds, in UTC
+	TimeUnix                            // Seconds since the Unix epoch
+	TimeUnixMilli                       // Milliseconds since the Unix epoch
+	TimeUnixNano                        // Nanoseconds since the Unix epoch
+)
+
+// DurationEncoding selects how writers render duration fields
+type DurationEncoding uint8
+
+const (
+	DurationString  DurationEncoding = iota // Go syntax, e.g. 1.5s
+	DurationNanos                           // Integer nanoseconds
+	DurationMillis                          // Fractional milliseconds
+	DurationSeconds                         // Fractional seconds
+)
+
+// valueEncoding holds a writer's choices for rendering field values. The
+// zero value is the default used by SetFormat.
+type valueEncoding struct {
+	bytes    BytesEncoding
+	time     TimeEncoding
+	duration DurationEncoding
+}
+
+// defaultValueEncoding is used where no writer configuration applies
+var defaultValueEncoding valueEncoding
+
+// appendTimeValue appends a time given in Unix nanoseconds. Textual
+// encodings are quoted when quote is set.
+func appendTimeValue(buf []byte, nanos int64, enc TimeEncoding, quote bool) []byte {
+	switch enc {
+	case TimeUnix:
+		return strconv.AppendInt(buf, nanos/int64(time.Second), 10)
+	case TimeUnixMilli:
+		return strconv.AppendInt(buf, nanos/int64(time.Millisecond), 10)
+	case TimeUnixNano:
+		return strconv.AppendInt(buf, nanos, 10)
+	default:
+		if quote {
+			buf = append(buf, '"')
+		}
+		buf = time.Unix(0, nanos).UTC().AppendFormat(buf, time.RFC3339Nano)
+		if quote {
+			buf = append(buf, '"')
+		}
+		return buf
+	}
+}
+
+// appendDurationValue appends a duration given in nanoseconds. Textual
+// encodings are quoted when quote is set.
+func appendDurationValue(buf []byte, nanos int64, enc DurationEncoding, quote bool) []byte {
+	switch enc {
+	case DurationNanos:
+		return strconv.AppendInt(buf, nanos, 10)
+	case DurationMillis:
+		return strconv.AppendFloat(buf, float64(nanos)/float64(time.Millisecond), 'f', -1, 64)
+	case DurationSeconds:
+		return strconv.AppendFloat(buf, float64(nanos)/float64(time.Second), 'f', -1, 64)
+	default:
+		if quote {
+			buf = append(buf, '"')
+		}
+		buf = appendDuration(buf, time.Duration(nanos))
+		if quote {
+			buf = append(buf, '"')
+		}
+		return buf
+	}
+}
+
+// appendDuration appends d formatted like time.Duration.String, without
+// the allocation
+func appendDuration(buf []byte, d time.Duration) []byte {
+	// Largest duration is 2562047h47m16.854775807s
+	var tmp [32]byte
+	w := len(tmp)
+
+	u := uint64(d)
+	neg := d < 0
+	if neg {
+		u = -u
+	}
+
+	if u < uint64(time.Second) {
+		// Sub-second: one unit with a fraction, e.g. 1.2ms
+		var prec int
+		w--
+		tmp[w] = 's'
+		w--
+		switch {
+		case u == 0:
+			return append(buf, '0', 's')
+		case u < uint64(time.Microsecond):
+			prec = 0
+			tmp[w] = 'n'
+		case u < uint64(time.Millisecond):
+			prec = 3
+			// U+00B5 micro sign
+			w--
+			copy(tmp[w:], "µ")
+		default:
+			prec = 6
+			tmp[w] = 'm'
+		}
+		w, u = fmtFrac(tmp[:w], u, prec)
+		w = fmtInt(tmp[:w], u)
+	} else {
+		w--
+		tmp[w] = 's'
+		w, u = fmtFrac(tmp[:w], u, 9)
+
+		// u is now whole seconds
+		w = fmtInt(tmp[:w], u%60)
+		u /= 60
+		if u > 0 {
+			w--
+			tmp[w] = 'm'
+			w = fmtInt(tmp[:w], u%60)
+			u /= 60
+			if u > 0 {
+				w--
+				tmp[w] = 'h'
+				w = fmtInt(tmp[:w], u)
+			}
+		}
+	}
+
+	if neg {
+		w--
+		tmp[w] = '-'
+	}
+	return append(buf, tmp[w:]...)
+}
+
+// fmtFrac formats the fraction of v/10**prec, omitting trailing zeros, at
+// the end of buf. It returns the start index and v/10**prec.
+func fmtFrac(buf []byte, v uint64, prec int) (int, uint64) {
+	w := len(buf)
+	printed := false
+	for i := 0; i < prec; i++ {
+		digit := v % 10
+		printed = printed || digit != 0
+		if printed {
+			w--
+			buf[w] = byte(digit) + '0'
+		}
+		v /= 10
+	}
+	if printed {
+		w--
+		buf[w] = '.'
+	}
+	return w, v
+}
+
+// fmtInt formats v at the end of buf and returns the start index
+func fmtInt(buf []byte, v uint64) int {
+	w := len(buf)
+	if v == 0 {
+		w--
+		buf[w] = '0'
+		return w
+	}
+	for v > 0 {
+		w--
+		buf[w] = byte(v%10) + '0'
+		v /= 10
+	}
+	return w
+}
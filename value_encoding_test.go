@@ -0,0 +1,137 @@
+package zlog
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendDuration(t *testing.T) {
+	for _, d := range []time.Duration{
+		0, 1, 999, time.Microsecond, 1500 * time.Nanosecond, time.Millisecond + 200*time.Microsecond,
+		time.Second, 1500 * time.Millisecond, 90 * time.Second, 3*time.Hour + 25*time.Minute + 100*time.Millisecond,
+		-1500 * time.Millisecond, -7, math.MaxInt64, math.MinInt64,
+	} {
+		if got := string(appendDuration(nil, d)); got != d.String() {
+			t.Errorf("appendDuration(%d) = %q, want %q", int64(d), got, d.String())
+		}
+	}
+}
+
+func TestTimeDurationFields(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 30, 0, 500, time.FixedZone("X", 3600))
+	fields := []Field{Time("at", ts), Duration("took", 1500*time.Millisecond)}
+
+	tests := []struct {
+		name  string
+		setup func(io.Writer) io.Writer
+		want  string
+	}{
+		{"JSONDefault", func(w io.Writer) io.Writer { return NewJSONWriter(w) },
+			`"at":"2024-03-01T11:30:00.0000005Z","took":"1.5s"}`},
+		{"JSONNumeric", func(w io.Writer) io.Writer {
+			jw := NewJSONWriter(w)
+			jw.SetTimeEncoding(TimeUnixMilli)
+			jw.SetDurationEncoding(DurationMillis)
+			return jw
+		}, `"at":1709292600000,"took":1500}`},
+		{"LogfmtDefault", func(w io.Writer) io.Writer { return NewLogfmtWriter(w) },
+			` at=2024-03-01T11:30:00.0000005Z took=1.5s`},
+		{"LogfmtNumeric", func(w io.Writer) io.Writer {
+			lw := NewLogfmtWriter(w)
+			lw.SetTimeEncoding(TimeUnix)
+			lw.SetDurationEncoding(DurationSeconds)
+			return lw
+		}, ` at=1709292600 took=1.5`},
+		{"Terminal", func(w io.Writer) io.Writer {
+			tw := NewTerminalWriter(w)
+			tw.SetTimeEncoding(TimeUnixNano)
+			tw.SetDurationEncoding(DurationNanos)
+			return tw
+		}, `at=1709292600000000500 took=1500000000`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := NewStructured()
+			logger.SetWriter(tt.setup(&out))
+			logger.Info("timed", fields...)
+
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("%q lacks %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeDurationKV(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&out))
+	logger.InfoKV("kv", "at", time.Unix(0, 0), "took", 2*time.Minute)
+
+	if !strings.HasSuffix(out.String(), `"at":"1970-01-01T00:00:00Z","took":"2m0s"}`+"\n") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestTimeOutOfRange(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetWriter(NewJSONWriter(&out))
+	logger.Info("m", Time("zero", time.Time{}), Time("far", time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)),
+		Time("edge", time.Unix(0, math.MinInt64+int64(time.Second))))
+
+	want := `"zero":"0001-01-01T00:00:00Z","far":"3000-01-01T00:00:00Z","edge":"1677-09-21T00:12:44.145224192Z"}`
+	if !strings.HasSuffix(out.String(), want+"\n") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestTimeDurationDirectFormats(t *testing.T) {
+	clock := ClockFunc(func() time.Time { return time.Unix(1700000000, 0) })
+	for _, tt := range []struct {
+		format LogFormat
+		writer func(io.Writer) io.Writer
+	}{
+		{FormatJSON, func(w io.Writer) io.Writer { return NewJSONWriter(w) }},
+		{FormatText, func(w io.Writer) io.Writer { return NewLogfmtWriter(w) }},
+	} {
+		var decoded, direct bytes.Buffer
+
+		viaWriter := NewStructured()
+		viaWriter.SetClock(clock)
+		viaWriter.SetWriter(tt.writer(&decoded))
+		viaWriter.Info("t", Time("at", time.Unix(5, 6)), Duration("took", 42*time.Microsecond))
+
+		viaFormat := NewStructured()
+		viaFormat.SetClock(clock)
+		viaFormat.SetFormat(tt.format)
+		viaFormat.SetWriter(&direct)
+		viaFormat.Info("t", Time("at", time.Unix(5, 6)), Duration("took", 42*time.Microsecond))
+
+		if direct.String() != decoded.String() {
+			t.Errorf("format %d: direct %q, writer %q", tt.format, direct.String(), decoded.String())
+		}
+	}
+}
+
+func TestTimeDurationZeroAlloc(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful under the race detector")
+	}
+	w := NewJSONWriter(io.Discard)
+	logger := NewStructured()
+	logger.SetWriter(w)
+	at := time.Now()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		logger.Info("timed", Time("at", at), Duration("took", time.Second))
+	})
+	if allocs > 1 { // The binary record itself escapes to the writer
+		t.Errorf("%.1f allocs per log", allocs)
+	}
+}
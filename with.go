@@ -0,0 +1,86 @@
+package zlog
+
+// contextFields holds fields attached with With, pre-encoded once in every
+// output format so each record only copies bytes
+type contextFields struct {
+	count  int
+	binary []byte // encoded as in a binary record
+	json   []byte // `,"key":value` pairs
+	logfmt []byte // ` key=value` pairs
+}
+
+// With returns a child logger that adds fields to every record it logs.
+// The child shares level, writer, format and sequence numbering with l.
+func (l *StructuredLogger) With(fields ...Field) *StructuredLogger {
+	ctx := &contextFields{}
+	if l.ctx != nil {
+		ctx.count = l.ctx.count
+		ctx.binary = append(ctx.binary, l.ctx.binary...)
+		ctx.json = append(ctx.json, l.ctx.json...)
+		ctx.logfmt = append(ctx.logfmt, l.ctx.logfmt...)
+	}
+
+	// Lazy values and errors are computed once, not for measuring and
+	// again for encoding
+	var payloads []byte
+	fields = resolveFields(nil, &payloads, fields)
+
+	var tmp []byte
+	for i := range fields {
+		if ctx.count == maxFieldCount {
+			break
+		}
+		f := &fields[i]
+
+		size := fieldSize(f)
+		if cap(tmp) < size {
+			tmp = make([]byte, size)
+		}
+		n := encodeField(tmp[:size], f)
+		ctx.binary = append(ctx.binary, tmp[:n]...)
+
+		// Text forms come from the binary encoding, which also snapshots
+		// objects and arrays
+		fr := fieldReader{b: tmp[:n], n: 1}
+		raw, ok := fr.next()
+		if !ok {
+			continue
+		}
+		num, data := decodeValue(raw.typ, raw.val)
+
+		ctx.json = append(ctx.json, ',')
+		ctx.json = appendJSONString(ctx.json, raw.key)
+		ctx.json = append(ctx.json, ':')
+		ctx.json = appendJSONValue(ctx.json, raw.typ, num, data, &defaultValueEncoding)
+
+		ctx.logfmt = appendLogfmtField(ctx.logfmt, raw.key, raw.typ, num, data, &defaultValueEncoding)
+		ctx.count++
+	}
+
+	return &StructuredLogger{
+		Logger:   l.Logger,
+		sequence: l.sequence,
+		ctx:      ctx,
+	}
+}
+
+// contextSize returns the encoded size of the context fields
+//
+//go:inline
+func (l *StructuredLogger) contextSize() int {
+	if l.ctx == nil {
+		return 0
+	}
+	return len(l.ctx.binary)
+}
+
+// writeContext copies the binary context fields to pos if they fit and
+// returns the new position and the number of fields written
+//
+//go:inline
+func (l *StructuredLogger) writeContext(buf []byte, pos int) (int, int) {
+	if l.ctx == nil || pos+len(l.ctx.binary) > len(buf) {
+		return pos, 0
+	}
+	return pos + copy(buf[pos:], l.ctx.binary), l.ctx.count
+}
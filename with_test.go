@@ -0,0 +1,140 @@
+package zlog
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWith(t *testing.T) {
+	var buf bytes.Buffer
+	parent := NewStructured()
+	parent.SetWriter(&buf)
+
+	child := parent.With(String("service", "api"), Int("shard", 3))
+	child.Info("hello", String("path", "/users"))
+	child.InfoKV("kv", "status", 200)
+	parent.Info("parent only")
+
+	var rec Record
+	b := buf.Bytes()
+	want := []struct {
+		msg  string
+		keys string
+		seq  uint64
+	}{
+		{"hello", "service,shard,path", 1},
+		{"kv", "service,shard,status", 2},
+		{"parent only", "", 3},
+	}
+	for _, w := range want {
+		n, err := DecodeRecord(b, &rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		fr := rec.fieldReader()
+		for {
+			f, ok := fr.next()
+			if !ok {
+				break
+			}
+			keys = append(keys, string(f.key))
+		}
+		if string(rec.Message) != w.msg || strings.Join(keys, ",") != w.keys || rec.Sequence != w.seq {
+			t.Errorf("got msg=%q keys=%v seq=%d, want %q %q %d", rec.Message, keys, rec.Sequence, w.msg, w.keys, w.seq)
+		}
+		b = b[n:]
+	}
+}
+
+func TestWithSharesConfiguration(t *testing.T) {
+	var first, second bytes.Buffer
+	parent := NewStructured()
+	parent.SetWriter(&first)
+	child := parent.With(String("k", "v"))
+
+	parent.SetLevel(LevelError)
+	child.Info("filtered")
+	if first.Len() != 0 {
+		t.Error("child ignored the parent's level")
+	}
+
+	parent.SetWriter(&second)
+	child.Error("moved")
+	if first.Len() != 0 || second.Len() == 0 {
+		t.Error("child ignored the parent's writer")
+	}
+}
+
+func TestWithNested(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewStructured()
+	logger.SetClock(ClockFunc(func() time.Time { return time.Unix(0, 0) }))
+	logger.SetWriter(NewLogfmtWriter(&out))
+
+	logger.With(String("a", "1")).With(Int("b", 2)).Info("nested", Bool("c", true))
+	if !strings.HasSuffix(out.String(), "msg=nested a=1 b=2 c=true\n") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestWithTextFormats(t *testing.T) {
+	clock := ClockFunc(func() time.Time { return time.Unix(1700000000, 0) })
+
+	for _, tt := range []struct {
+		format LogFormat
+		writer func(io.Writer) io.Writer
+	}{
+		{FormatJSON, func(w io.Writer) io.Writer { return NewJSONWriter(w) }},
+		{FormatText, func(w io.Writer) io.Writer { return NewLogfmtWriter(w) }},
+	} {
+		var decoded, direct bytes.Buffer
+
+		viaWriter := NewStructured()
+		viaWriter.SetClock(clock)
+		viaWriter.SetWriter(tt.writer(&decoded))
+		viaWriter.With(String("svc", "a b"), Bytes("id", []byte{1})).Warn("w", Int("n", 1))
+
+		viaFormat := NewStructured()
+		viaFormat.SetClock(clock)
+		viaFormat.SetFormat(tt.format)
+		viaFormat.SetWriter(&direct)
+		viaFormat.With(String("svc", "a b"), Bytes("id", []byte{1})).Warn("w", Int("n", 1))
+
+		if direct.String() != decoded.String() {
+			t.Errorf("format %d: direct %q, writer %q", tt.format, direct.String(), decoded.String())
+		}
+	}
+}
+
+func TestWithZeroAlloc(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not meaningful under the race detector")
+	}
+	logger := NewStructured()
+	logger.SetWriter(io.Discard)
+	logger.SetFormat(FormatJSON)
+	child := logger.With(String("service", "api"), String("request_id", "abc123"))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		child.Info("request", Int("status", 200))
+	})
+	if allocs != 0 {
+		t.Errorf("child logger allocated %.1f times per log", allocs)
+	}
+}
+
+func BenchmarkWith(b *testing.B) {
+	logger := NewStructured()
+	logger.SetWriter(io.Discard)
+	child := logger.With(String("service", "api"), String("request_id", "abc123"), String("tenant", "acme"))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		child.Info("request", Int("status", 200))
+	}
+}